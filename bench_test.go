@@ -31,3 +31,33 @@ func BenchmarkBoxGetWithValues(b *testing.B) {
 		app.ServeHTTP(nil, r)
 	}
 }
+
+func BenchmarkStaticRoute(b *testing.B) {
+	app := New()
+	app.Get("/hello/:name", func(ctx *Context) error { return nil })
+	app.Get("/users/profile/settings", func(ctx *Context) error { return nil })
+
+	r, err := http.NewRequest("GET", "/users/profile/settings", nil)
+	if err != nil {
+		panic(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		app.ServeHTTP(nil, r)
+	}
+}
+
+func BenchmarkParamRoute(b *testing.B) {
+	app := New()
+	app.Get("/users/profile/settings", func(ctx *Context) error { return nil })
+	app.Get("/hello/:name", func(ctx *Context) error { return nil })
+
+	r, err := http.NewRequest("GET", "/hello/anthony", nil)
+	if err != nil {
+		panic(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		app.ServeHTTP(nil, r)
+	}
+}
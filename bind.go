@@ -0,0 +1,201 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// Binder decodes the body of the request into v.
+type Binder func(c *Context, v interface{}) error
+
+// RegisterBinder registers the Binder that Context.Bind uses for requests with
+// the given Content-Type. Binders are shared by the application and all of its
+// boxes. JSON, XML and form bodies are supported out of the box, registering
+// one of those content types replaces the default Binder.
+// 	app.RegisterBinder("application/msgpack", func(c *weavebox.Context, v interface{}) error {
+// 		return msgpack.NewDecoder(c.Request().Body).Decode(v)
+// 	})
+func (w *Weavebox) RegisterBinder(contentType string, b Binder) {
+	w.mustNotServe()
+	w.binders[contentType] = b
+}
+
+// FieldErrors is implemented by validation errors that report a message per
+// field, like ValidationErrors. The default errorHandler responds to them with
+// a 422 and a JSON object like {"errors":{"email":"required"}}.
+type FieldErrors interface {
+	error
+	FieldErrors() map[string]string
+}
+
+// SetValidator sets the func Context.Bind uses to validate the bound value.
+// When the returned error implements FieldErrors it is returned by Bind as is,
+// any other error is returned as an HTTPError with status 400.
+// 	app.SetValidator(func(v interface{}) error {
+// 		return validate.Struct(v)
+// 	})
+func (w *Weavebox) SetValidator(fn func(v interface{}) error) {
+	w.mustNotServe()
+	w.validator = fn
+}
+
+func (c *Context) validate(v interface{}) error {
+	if c.weavebox == nil || c.weavebox.validator == nil {
+		return nil
+	}
+	err := c.weavebox.validator(v)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(FieldErrors); ok {
+		return err
+	}
+	return c.HTTPError(http.StatusBadRequest, err.Error())
+}
+
+func defaultBinders() map[string]Binder {
+	return map[string]Binder{
+		"application/json":                  bindJSON,
+		"application/xml":                   bindXML,
+		"text/xml":                          bindXML,
+		"application/x-www-form-urlencoded": bindForm,
+		"multipart/form-data":               bindForm,
+	}
+}
+
+// lookupBinder returns the Binder registered for the Content-Type of the
+// request. Requests without a known Content-Type are bound as JSON.
+func (c *Context) lookupBinder() Binder {
+	if c.weavebox == nil {
+		return bindJSON
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.request.Header.Get("Content-Type"))
+	if b, ok := c.weavebox.binders[mediaType]; ok {
+		return b
+	}
+	if b, ok := c.weavebox.binders["application/json"]; ok {
+		return b
+	}
+	return bindJSON
+}
+
+func bindJSON(c *Context, v interface{}) error {
+	body, err := c.Body()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		if _, ok := err.(*json.InvalidUnmarshalError); ok {
+			return err
+		}
+		return c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+func bindXML(c *Context, v interface{}) error {
+	body, err := c.Body()
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, v); err != nil {
+		return c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// bindForm maps the form values on the fields of v using the form struct tag.
+func bindForm(c *Context, v interface{}) error {
+	if err := c.parseMultipartForm(); err != nil {
+		return c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := bindValues(v, c.request.PostForm, "form"); err != nil {
+		return c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// bindValues maps the given url.Values on the fields of the struct v points to.
+// The name of a field is taken from the given struct tag, or the field name
+// if the tag is missing. Fields tagged with "-" are skipped.
+func bindValues(v interface{}, values url.Values, tag string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind: v must be a pointer to a struct")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get(tag)
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+			for j, val := range vals {
+				if err := setValue(slice.Index(j), val); err != nil {
+					return fmt.Errorf("bind: invalid value %q for %s", val, name)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := setValue(fv, vals[0]); err != nil {
+			return fmt.Errorf("bind: invalid value %q for %s", vals[0], name)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("bind: unsupported kind %s", v.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package weavebox
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContextBindQuery(t *testing.T) {
+	type filter struct {
+		Tags    []string `query:"tag"`
+		Limit   int      `query:"limit"`
+		Active  bool     `query:"active"`
+		Score   float64  `query:"score"`
+		Ignored string   `query:"-"`
+	}
+
+	req, _ := http.NewRequest("GET", "/?tag=a&tag=b&limit=25&active=true&score=1.5&Ignored=x", nil)
+	ctx := &Context{request: req}
+	var f filter
+	if err := ctx.BindQuery(&f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Tags) != 2 || f.Tags[0] != "a" || f.Tags[1] != "b" {
+		t.Errorf("expecting tags [a b] got %v", f.Tags)
+	}
+	if want, have := 25, f.Limit; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if !f.Active {
+		t.Error("expecting active to be true")
+	}
+	if want, have := 1.5, f.Score; want != have {
+		t.Errorf("expecting %f have %f", want, have)
+	}
+	if f.Ignored != "" {
+		t.Errorf("expecting ignored field to be empty got %s", f.Ignored)
+	}
+
+	req, _ = http.NewRequest("GET", "/?limit=abc", nil)
+	ctx = &Context{request: req}
+	err := ctx.BindQuery(&f)
+	httpErr, ok := err.(HTTPError)
+	if !ok {
+		t.Fatalf("expecting HTTPError got %v", err)
+	}
+	if want, have := http.StatusBadRequest, httpErr.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+func TestContextBindGET(t *testing.T) {
+	w := New()
+	w.Get("/search", func(c *Context) error {
+		var v struct {
+			Q string `query:"q"`
+		}
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, v.Q)
+	})
+
+	code, body := doRequest(t, "GET", "/search?q=weavebox", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "weavebox", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextBindContentType(t *testing.T) {
+	w := New()
+	w.RegisterBinder("text/plain", func(c *Context, v interface{}) error {
+		body, err := c.readBody()
+		if err != nil {
+			return err
+		}
+		v.(*struct {
+			Name string `json:"name" xml:"name" form:"name"`
+		}).Name = strings.ToUpper(string(body))
+		return nil
+	})
+	w.Post("/", func(c *Context) error {
+		var v struct {
+			Name string `json:"name" xml:"name" form:"name"`
+		}
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, v.Name)
+	})
+
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"", `{"name":"anthony"}`, "anthony"},
+		{"application/json; charset=utf-8", `{"name":"anthony"}`, "anthony"},
+		{"application/xml", `<user><name>anthony</name></user>`, "anthony"},
+		{"application/x-www-form-urlencoded", `name=anthony`, "anthony"},
+		{"text/plain", `anthony`, "ANTHONY"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/", strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if want, have := test.want, rw.Body.String(); want != have {
+			t.Errorf("%s: expecting %s have %s", test.contentType, want, have)
+		}
+	}
+}
+
+func TestContextBindMalformed(t *testing.T) {
+	w := New()
+	w.Post("/", func(c *Context) error {
+		var v struct {
+			Name string `json:"name" xml:"name"`
+		}
+		return c.Bind(&v)
+	})
+
+	for contentType, body := range map[string]string{
+		"application/json": `{"name":`,
+		"application/xml":  `<user><name>`,
+	} {
+		r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := http.StatusBadRequest, rw.Code; want != have {
+			t.Errorf("%s: expecting %d have %d", contentType, want, have)
+		}
+	}
+}
+
+func TestContextBindParams(t *testing.T) {
+	w := New()
+	w.Get("/users/:id/posts/:postId", func(c *Context) error {
+		var v struct {
+			ID     int    `param:"id"`
+			PostID int    `param:"postId"`
+			Name   string `param:"name"`
+		}
+		if err := c.BindParams(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, fmt.Sprintf("%d %d", v.ID, v.PostID))
+	})
+
+	code, body := doRequest(t, "GET", "/users/1/posts/42", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "1 42", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	code, _ = doRequest(t, "GET", "/users/anthony/posts/42", nil, w)
+	if want, have := http.StatusBadRequest, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+type signupErrors map[string]string
+
+func (e signupErrors) Error() string {
+	return "invalid signup"
+}
+
+func (e signupErrors) FieldErrors() map[string]string {
+	return e
+}
+
+func TestDefaultErrorHandlerFieldErrors(t *testing.T) {
+	w := New()
+	w.Post("/signup", func(c *Context) error {
+		return signupErrors{"email": "required", "name": "too short"}
+	})
+
+	code, body := doRequest(t, "POST", "/signup", nil, w)
+	if want, have := http.StatusUnprocessableEntity, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := `{"errors":{"email":"required","name":"too short"}}`, strings.TrimSpace(body); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextBindValidator(t *testing.T) {
+	w := New()
+	w.SetValidator(func(v interface{}) error {
+		s := v.(*struct{ Email, Name string })
+		if s.Name == "error" {
+			return errors.New("invalid name")
+		}
+		if s.Email == "" {
+			return signupErrors{"email": "required"}
+		}
+		if s.Email == "invalid" {
+			return ValidationErrors{{Field: "email", Message: "invalid"}}
+		}
+		return nil
+	})
+	w.Post("/", func(c *Context) error {
+		var v struct{ Email, Name string }
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, v.Email)
+	})
+
+	tests := []struct {
+		body string
+		code int
+		resp string
+	}{
+		{`{"email":"a@b.c"}`, http.StatusOK, "a@b.c"},
+		{`{"name":"anthony"}`, http.StatusUnprocessableEntity, `{"errors":{"email":"required"}}`},
+		{`{"name":"error"}`, http.StatusBadRequest, "invalid name"},
+		{`{"email":"invalid"}`, http.StatusUnprocessableEntity, `[{"field":"email","message":"invalid"}]`},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "POST", "/", strings.NewReader(test.body), w)
+		if want, have := test.code, code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.body, want, have)
+		}
+		if want, have := test.resp, strings.TrimSpace(body); want != have {
+			t.Errorf("%s: expecting %s have %s", test.body, want, have)
+		}
+	}
+}
+
+func TestContextBody(t *testing.T) {
+	w := New()
+	w.Post("/webhook", func(c *Context) error {
+		raw, err := c.Body()
+		if err != nil {
+			return err
+		}
+		again, _ := c.Body()
+		var v struct{ Event string }
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, fmt.Sprintf("%s %d %s", raw, len(again), v.Event))
+	})
+
+	code, body := doRequest(t, "POST", "/webhook", strings.NewReader(`{"event":"push"}`), w)
+	isHTTPStatusOK(t, code)
+	if want, have := `{"event":"push"} 16 push`, body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
@@ -0,0 +1,94 @@
+package weavebox
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// BufferResponse buffers the response in memory from here on. The buffer is
+// only written to the client when the handler returns nil. When it returns an
+// error or panics, the buffered status, headers and body are discarded, so the
+// ErrorHandler can write a clean response. The whole body is kept in memory,
+// so avoid buffering large responses or streams.
+// 	func transfer(ctx *weavebox.Context) error {
+// 		ctx.BufferResponse()
+// 		..
+// 	}
+func (c *Context) BufferResponse() {
+	if c.buffer != nil {
+		return
+	}
+	c.buffer = &bufferedResponse{
+		orig:   c.response,
+		header: cloneHeader(c.response.Header()),
+	}
+	c.response = &responseLogger{w: c.buffer}
+}
+
+// endBuffer restores the original response and writes the buffered response
+// to it when flush is true.
+func (c *Context) endBuffer(flush bool) {
+	b := c.buffer
+	if b == nil {
+		return
+	}
+	c.buffer = nil
+	c.response = b.orig
+	if !flush {
+		return
+	}
+	header := b.orig.Header()
+	for key := range header {
+		if _, ok := b.header[key]; !ok {
+			delete(header, key)
+		}
+	}
+	for key, values := range b.header {
+		header[key] = values
+	}
+	if b.status == 0 {
+		return
+	}
+	b.orig.WriteHeader(b.status)
+	b.orig.Write(b.body.Bytes())
+}
+
+// bufferedResponse is a http.ResponseWriter that keeps the response in memory.
+type bufferedResponse struct {
+	orig   http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection, which
+// is not affected by buffering the response.
+func (b *bufferedResponse) SetReadDeadline(deadline time.Time) error {
+	return http.NewResponseController(b.orig).SetReadDeadline(deadline)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for key, values := range h {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
@@ -0,0 +1,63 @@
+package weavebox
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBufferResponse(t *testing.T) {
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SetHeader("X-Request-ID", "abc")
+			return next(c)
+		}
+	})
+	w.Get("/ok", func(c *Context) error {
+		c.BufferResponse()
+		c.SetHeader("X-Result", "ok")
+		return c.Text(http.StatusCreated, "created")
+	})
+	w.Get("/fail", func(c *Context) error {
+		c.BufferResponse()
+		c.SetHeader("X-Result", "ok")
+		c.Text(http.StatusOK, "half")
+		return errors.New("rollback")
+	})
+	w.Get("/panic", func(c *Context) error {
+		c.BufferResponse()
+		c.Text(http.StatusOK, "half")
+		panic("boom")
+	})
+	w.SetLogger(&logRecorder{})
+
+	tests := []struct {
+		route  string
+		code   int
+		body   string
+		result string
+	}{
+		{"/ok", http.StatusCreated, "created", "ok"},
+		{"/fail", http.StatusInternalServerError, "rollback\n", ""},
+		{"/panic", http.StatusInternalServerError, "boom\n", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.route, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := test.code, rw.Code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.route, want, have)
+		}
+		if want, have := test.body, rw.Body.String(); want != have {
+			t.Errorf("%s: expecting %q have %q", test.route, want, have)
+		}
+		if want, have := test.result, rw.Header().Get("X-Result"); want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
+		}
+		if want, have := "abc", rw.Header().Get("X-Request-ID"); want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
+		}
+	}
+}
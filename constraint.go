@@ -0,0 +1,74 @@
+package weavebox
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// paramConstraint restricts the values of a route param. When badRequest is
+// set a failing value results in a 400, otherwise the route does not match.
+type paramConstraint struct {
+	param      string
+	match      func(string) bool
+	badRequest bool
+}
+
+// Where constrains the values of the given param. When a value does not
+// match, the route is treated as not matching and the request is handled as
+// not found, so a Fallback or the not found handler of the box responds.
+// 	app.Get("/users/:id", userHandler).Where("id", weavebox.Numeric)
+func (r *Route) Where(param string, match func(string) bool) *Route {
+	r.weavebox.mustNotServe()
+	r.constraints = append(r.constraints, paramConstraint{param: param, match: match})
+	return r
+}
+
+// Require constrains the values of the given param like Where, but a value
+// that does not match results in an HTTPError with status 400 passed to the
+// ErrorHandler, as the route matched but the param is invalid.
+// 	app.Get("/users/:id", userHandler).Require("id", weavebox.Numeric)
+func (r *Route) Require(param string, match func(string) bool) *Route {
+	r.weavebox.mustNotServe()
+	r.constraints = append(r.constraints, paramConstraint{param: param, match: match, badRequest: true})
+	return r
+}
+
+// failedConstraint returns the first constraint of the route that is not met
+// by the given params.
+func (r *Route) failedConstraint(params httprouter.Params) (paramConstraint, bool) {
+	for _, c := range r.constraints {
+		if !c.match(params.ByName(c.param)) {
+			return c, true
+		}
+	}
+	return paramConstraint{}, false
+}
+
+// httpError returns the HTTPError for a Require constraint that failed.
+func (c paramConstraint) httpError(ctx *Context) HTTPError {
+	return ctx.HTTPError(http.StatusBadRequest, fmt.Sprintf("invalid parameter %s", c.param))
+}
+
+// Numeric reports whether s is a non empty string of decimal digits.
+func Numeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Pattern returns a constraint that matches params that match the given
+// regular expression as a whole. It panics if expr can not be compiled.
+// 	app.Get("/posts/:slug", postHandler).Where("slug", weavebox.Pattern(`[a-z0-9-]+`))
+func Pattern(expr string) func(string) bool {
+	re := regexp.MustCompile("^(?:" + expr + ")$")
+	return re.MatchString
+}
@@ -0,0 +1,40 @@
+package weavebox
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRouteConstraints(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", noopHandler).Where("id", Numeric)
+	w.Get("/posts/:id", noopHandler).Require("id", Numeric)
+	pages := w.Box("/pages")
+	pages.Get("/:slug", noopHandler).Where("slug", Pattern(`[a-z-]+`))
+	pages.Fallback(func(c *Context) error {
+		return c.Text(http.StatusOK, "fallback")
+	})
+
+	tests := []struct {
+		route string
+		code  int
+		body  string
+	}{
+		{"/users/42", http.StatusOK, ""},
+		{"/users/anthony", http.StatusNotFound, ""},
+		{"/posts/42", http.StatusOK, ""},
+		{"/posts/first", http.StatusBadRequest, "invalid parameter id"},
+		{"/pages/about-us", http.StatusOK, ""},
+		{"/pages/About", http.StatusOK, "fallback"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		if want, have := test.code, code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.route, want, have)
+		}
+		if test.body != "" && !strings.Contains(body, test.body) {
+			t.Errorf("%s: expecting %s have %s", test.route, test.body, body)
+		}
+	}
+}
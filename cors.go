@@ -0,0 +1,105 @@
+package weavebox
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the cross origin resource sharing of CORS.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross origin requests.
+	// "*" allows all origins, it can not be combined with AllowCredentials.
+	AllowedOrigins []string
+
+	// AllowedHeaders lists the request headers allowed in cross origin
+	// requests. When empty, the headers requested by the preflight request are
+	// allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers the browser may expose to the
+	// client.
+	ExposedHeaders []string
+
+	// AllowCredentials allows cookies and authorization headers to be send
+	// with cross origin requests.
+	AllowCredentials bool
+
+	// MaxAge is the time the browser may cache the result of a preflight
+	// request. Zero leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// CORS enables cross origin resource sharing for the allowed origins. Preflight
+// OPTIONS requests are answered by weavebox, with the methods actually
+// registered for the requested path in the Access-Control-Allow-Methods
+// header. Like UseHTTP, CORS only has effect on the application that serves
+// the requests, not on a Box. CORS panics when "*" is allowed together with
+// credentials, as that would let any website read the responses of a logged in
+// user.
+// 	app.CORS(weavebox.CORSOptions{
+// 		AllowedOrigins: []string{"https://example.com"},
+// 		MaxAge:         time.Hour,
+// 	})
+func (w *Weavebox) CORS(opts CORSOptions) {
+	origins := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		origins[origin] = true
+	}
+	if origins["*"] && opts.AllowCredentials {
+		panic("weavebox: CORS can not allow credentials for all origins (*)")
+	}
+	w.UseHTTP(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			header := rw.Header()
+			// the response depends on the origin, also when it is not
+			// allowed, so caches must not serve it to other origins
+			if !origins["*"] {
+				header.Add("Vary", "Origin")
+			}
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(origins["*"] || origins[origin]) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			if origins["*"] {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			reqMethod := r.Header.Get("Access-Control-Request-Method")
+			if r.Method != "OPTIONS" || reqMethod == "" {
+				if len(opts.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			p := r.URL.Path
+			if w.CaseInsensitive {
+				p = lowerASCII(p)
+			}
+			methods := w.allowedMethods(p)
+			if len(methods) == 0 {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(opts.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+			} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if opts.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			rw.WriteHeader(http.StatusNoContent)
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	w := New()
+	w.CORS(CORSOptions{
+		AllowedOrigins: []string{"https://example.com"},
+		MaxAge:         time.Hour,
+	})
+	w.Get("/users/:id", noopHandler)
+	w.Put("/users/:id", noopHandler)
+	w.Post("/users", noopHandler)
+
+	r, _ := http.NewRequest("OPTIONS", "/users/1", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := http.StatusNoContent, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	for key, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://example.com",
+		"Access-Control-Allow-Methods": "GET, PUT",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Access-Control-Max-Age":       "3600",
+	} {
+		if have := rw.Header().Get(key); want != have {
+			t.Errorf("%s: expecting %s have %s", key, want, have)
+		}
+	}
+
+	r, _ = http.NewRequest("OPTIONS", "/users/1", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if have := rw.Header().Get("Access-Control-Allow-Origin"); have != "" {
+		t.Errorf("expecting no allowed origin have %s", have)
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	w := New()
+	w.CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://example.com"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+	})
+	w.Get("/", noopHandler)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://example.com")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	for key, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "X-Request-ID",
+	} {
+		if have := rw.Header().Get(key); want != have {
+			t.Errorf("%s: expecting %s have %s", key, want, have)
+		}
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	w := New()
+	w.CORS(CORSOptions{AllowedOrigins: []string{"https://example.com"}})
+	w.Get("/", noopHandler)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if have := rw.Header().Get("Access-Control-Allow-Origin"); have != "" {
+		t.Errorf("expecting no allowed origin have %s", have)
+	}
+	if want, have := "Origin", rw.Header().Get("Vary"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	w := New()
+	w.CORS(CORSOptions{AllowedOrigins: []string{"*"}})
+	w.Get("/", noopHandler)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := "*", rw.Header().Get("Access-Control-Allow-Origin"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if have := rw.Header().Get("Access-Control-Allow-Credentials"); have != "" {
+		t.Errorf("expecting no credentials header have %s", have)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expecting a panic allowing credentials for all origins")
+		}
+	}()
+	New().CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
@@ -0,0 +1,42 @@
+package weavebox
+
+import "net/http"
+
+// HealthCheck registers a GET route on the given path that responds with a
+// 200 when check returns nil, and with a 503 otherwise.
+// 	app.HealthCheck("/healthz", func() error { return nil })
+// 	app.HealthCheck("/readyz", db.Ping)
+func (w *Weavebox) HealthCheck(path string, check func() error) *Route {
+	return w.HealthChecks(path, map[string]func() error{"check": check})
+}
+
+// HealthChecks registers a GET route on the given path that runs all the named
+// checks. It responds with a 200 when all checks pass, and with a 503 if any
+// of them fails. The body reports the result of each check.
+// 	{"status":"error","checks":{"cache":"ok","db":"connection refused"}}
+func (w *Weavebox) HealthChecks(path string, checks map[string]func() error) *Route {
+	return w.Get(path, func(c *Context) error {
+		resp := healthResponse{
+			Status: "ok",
+			Checks: make(map[string]string, len(checks)),
+		}
+		for name, check := range checks {
+			if err := check(); err != nil {
+				resp.Status = "error"
+				resp.Checks[name] = err.Error()
+				continue
+			}
+			resp.Checks[name] = "ok"
+		}
+		code := http.StatusOK
+		if resp.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, resp)
+	})
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
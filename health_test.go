@@ -0,0 +1,39 @@
+package weavebox
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	w := New()
+	w.HealthCheck("/healthz", func() error { return nil })
+	w.HealthChecks("/readyz", map[string]func() error{
+		"cache": func() error { return nil },
+		"db":    func() error { return errors.New("connection refused") },
+	})
+
+	code, _ := doRequest(t, "GET", "/healthz", nil, w)
+	isHTTPStatusOK(t, code)
+
+	code, body := doRequest(t, "GET", "/readyz", nil, w)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expecting code 503 got %d", code)
+	}
+	var resp healthResponse
+	if err := json.NewDecoder(strings.NewReader(body)).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "error", resp.Status; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "ok", resp.Checks["cache"]; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "connection refused", resp.Checks["db"]; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
@@ -0,0 +1,258 @@
+package weavebox
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MethodOverride returns a net/http middleware that rewrites the method of a
+// POST request to the method given in the X-HTTP-Method-Override header or the
+// _method form field. This allows HTML forms to reach PUT, PATCH and DELETE
+// routes. It must be registered with UseHTTP so it runs before routing.
+//
+// Only POST requests can be overridden, and only to PUT, PATCH or DELETE. This
+// keeps safe methods like GET free of side effects, and prevents a link or
+// image tag from triggering a destructive route. Make sure routes reachable
+// trough an override are protected against CSRF like any other POST.
+// 	app.UseHTTP(weavebox.MethodOverride())
+func MethodOverride() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "POST" {
+				method := r.Header.Get("X-HTTP-Method-Override")
+				if method == "" {
+					method = r.FormValue("_method")
+				}
+				switch method = strings.ToUpper(method); method {
+				case "PUT", "PATCH", "DELETE":
+					r.Method = method
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AllowedMethods returns a net/http middleware that rejects requests with a
+// method not in the given list with a 405 Method Not Allowed, before the
+// request reaches the router.
+// 	app.UseHTTP(weavebox.AllowedMethods("GET", "POST", "PUT", "DELETE"))
+func AllowedMethods(methods ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+	allow := strings.Join(methods, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed[r.Method] {
+				w.Header().Set("Allow", allow)
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const (
+	csrfCookieName = "_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// CSRF returns a middleware that protects against cross site request forgery.
+// A token is stored in a cookie and must be send back in the X-CSRF-Token
+// header or the csrf_token form field for all requests that are not GET,
+// HEAD or OPTIONS. Otherwise an HTTPError with status 403 is returned. The
+// token is available trough Context.CSRFToken and in rendered templates as
+// {{.csrfToken}}.
+func CSRF() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			var token string
+			if cookie, err := c.Request().Cookie(csrfCookieName); err == nil {
+				token = cookie.Value
+			}
+			if token == "" {
+				b := make([]byte, 32)
+				if _, err := rand.Read(b); err != nil {
+					return err
+				}
+				token = base64.RawURLEncoding.EncodeToString(b)
+				http.SetCookie(c.Response(), &http.Cookie{
+					Name:     csrfCookieName,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+				})
+			}
+			c.Set(csrfKey, token)
+
+			switch c.Request().Method {
+			case "GET", "HEAD", "OPTIONS":
+				return next(c)
+			}
+			sent := c.Header(csrfHeaderName)
+			if sent == "" {
+				sent = c.Form(csrfFormField)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				return c.HTTPError(http.StatusForbidden, "invalid csrf token")
+			}
+			return next(c)
+		}
+	}
+}
+
+// CSRFToken returns the CSRF token of the current request, or an empty string
+// if the CSRF middleware is not used.
+func (c *Context) CSRFToken() string {
+	token, _ := c.Get(csrfKey).(string)
+	return token
+}
+
+// AllowedHosts returns a net/http middleware that rejects requests whose Host
+// header is not in the given list with a 421 Misdirected Request. This
+// prevents Host header injection and cache poisoning. The port of the Host
+// header is ignored.
+// 	app.UseHTTP(weavebox.AllowedHosts("example.com", "www.example.com"))
+func AllowedHosts(hosts ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if !allowed[strings.ToLower(host)] {
+				http.Error(w, http.StatusText(http.StatusMisdirectedRequest), http.StatusMisdirectedRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID returns a middleware that assigns an id to each request. The id
+// is taken from the X-Request-ID header, or generated if it is missing, and
+// is set on the response as well. The id is available trough
+// Context.RequestID and is added to each line logged with Context.Log.
+func RequestID() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			id := c.Header(requestIDHeader)
+			if id == "" {
+				b := make([]byte, 16)
+				if _, err := rand.Read(b); err != nil {
+					return err
+				}
+				id = hex.EncodeToString(b)
+			}
+			c.SetHeader(requestIDHeader, id)
+			c.Set(requestIDKey, id)
+			return next(c)
+		}
+	}
+}
+
+// RequestID returns the id of the current request, or an empty string if the
+// RequestID middleware is not used.
+func (c *Context) RequestID() string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
+
+// Decompress returns a middleware that decompresses request bodies send with
+// a gzip or deflate Content-Encoding, so Bind and friends read plain text.
+// An HTTPError with status 400 is returned when the body is not a valid
+// compressed stream.
+// 	app.Use(weavebox.Decompress())
+func Decompress() Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			r := c.Request()
+			var (
+				zr  io.ReadCloser
+				err error
+			)
+			switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+			case "gzip", "x-gzip":
+				zr, err = gzip.NewReader(r.Body)
+			case "deflate":
+				zr, err = zlib.NewReader(r.Body)
+			default:
+				return next(c)
+			}
+			if err != nil {
+				return c.HTTPError(http.StatusBadRequest, "malformed compressed request body")
+			}
+			r.Body = &decompressReader{zr: zr, body: r.Body}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			return next(c)
+		}
+	}
+}
+
+// decompressReader reports a corrupt stream as an HTTPError with status 400
+// and closes both the decompressor and the original body.
+type decompressReader struct {
+	zr   io.ReadCloser
+	body io.ReadCloser
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	n, err := r.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = HTTPError{
+			Code:        http.StatusBadRequest,
+			Description: "malformed compressed request body",
+		}
+	}
+	return n, err
+}
+
+func (r *decompressReader) Close() error {
+	r.zr.Close()
+	return r.body.Close()
+}
+
+// RequireContentType returns a middleware that rejects POST, PUT and PATCH
+// requests with a Content-Type other than the given types with an HTTPError
+// with status 415. Parameters like charset are ignored. Requests with other
+// methods are not checked.
+// 	app.Use(weavebox.RequireContentType("application/json"))
+func RequireContentType(types ...string) Middleware {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[strings.ToLower(t)] = true
+	}
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			switch c.Request().Method {
+			case "POST", "PUT", "PATCH":
+				mediaType, _, _ := mime.ParseMediaType(c.Header("Content-Type"))
+				if !allowed[mediaType] {
+					return c.HTTPError(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType))
+				}
+			}
+			return next(c)
+		}
+	}
+}
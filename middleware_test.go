@@ -0,0 +1,276 @@
+package weavebox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMethodOverride(t *testing.T) {
+	w := New()
+	w.UseHTTP(MethodOverride())
+	w.Delete("/", func(c *Context) error {
+		return c.Text(http.StatusOK, "deleted")
+	})
+	w.Get("/", noopHandler)
+
+	values := url.Values{}
+	values.Set("_method", "DELETE")
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "deleted", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ = http.NewRequest("POST", "/", nil)
+	r.Header.Set("X-HTTP-Method-Override", "DELETE")
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-HTTP-Method-Override", "DELETE")
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Body.String() == "deleted" {
+		t.Error("GET requests cannot be overridden")
+	}
+}
+
+func TestAllowedMethods(t *testing.T) {
+	w := New()
+	w.UseHTTP(AllowedMethods("GET", "POST", "PUT", "DELETE"))
+	w.Handle("TRACE", "/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w.Get("/", noopHandler)
+
+	code, _ := doRequest(t, "TRACE", "/", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+	code, _ = doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+type stringRenderer struct {
+	templ *template.Template
+}
+
+func (r stringRenderer) Render(w io.Writer, name string, data interface{}) error {
+	return r.templ.Execute(w, data)
+}
+
+func TestCSRF(t *testing.T) {
+	w := New()
+	w.SetTemplateEngine(stringRenderer{template.Must(template.New("form").Parse(
+		`<input name="csrf_token" value="{{.csrfToken}}">`,
+	))})
+	w.Use(CSRF())
+	w.Get("/form", func(c *Context) error {
+		return c.Render("form", nil)
+	})
+	w.Post("/form", noopHandler)
+
+	r, _ := http.NewRequest("GET", "/form", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	cookies := rw.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expecting a csrf cookie got %d cookies", len(cookies))
+	}
+	token := cookies[0].Value
+	if want, have := `<input name="csrf_token" value="`+token+`">`, rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ = http.NewRequest("POST", "/form", nil)
+	r.AddCookie(cookies[0])
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusForbidden {
+		t.Errorf("expecting code 403 got %d", rw.Code)
+	}
+
+	values := url.Values{}
+	values.Set("csrf_token", token)
+	r, _ = http.NewRequest("POST", "/form", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(cookies[0])
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+}
+
+func TestAllowedHosts(t *testing.T) {
+	w := New()
+	w.UseHTTP(AllowedHosts("example.com"))
+	w.Get("/", noopHandler)
+
+	for host, code := range map[string]int{
+		"example.com":      http.StatusOK,
+		"EXAMPLE.com:8080": http.StatusOK,
+		"evil.com":         http.StatusMisdirectedRequest,
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Host = host
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if rw.Code != code {
+			t.Errorf("%s: expecting code %d got %d", host, code, rw.Code)
+		}
+	}
+}
+
+type logRecorder struct {
+	lines [][]interface{}
+}
+
+func (l *logRecorder) Log(keyvals ...interface{}) error {
+	l.lines = append(l.lines, keyvals)
+	return nil
+}
+
+func TestRequestIDLogger(t *testing.T) {
+	logger := &logRecorder{}
+	w := New()
+	w.SetLogger(logger)
+	w.Use(RequestID())
+	w.Get("/users/:id", func(c *Context) error {
+		c.Log("msg", "hello")
+		return nil
+	})
+
+	r, _ := http.NewRequest("GET", "/users/1", nil)
+	r.Header.Set("X-Request-ID", "abc")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "abc", rw.Header().Get("X-Request-ID"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if len(logger.lines) != 1 {
+		t.Fatalf("expecting 1 log line got %d", len(logger.lines))
+	}
+	want := []interface{}{"route", "/users/:id", "request_id", "abc", "msg", "hello"}
+	if have := logger.lines[0]; !reflect.DeepEqual(want, have) {
+		t.Errorf("expecting %v have %v", want, have)
+	}
+
+	r, _ = http.NewRequest("GET", "/users/1", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if len(rw.Header().Get("X-Request-ID")) != 32 {
+		t.Errorf("expecting a generated request id got %s", rw.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	w := New()
+	w.Use(Decompress())
+	w.Post("/", func(c *Context) error {
+		var v struct{ Name string }
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, v.Name)
+	})
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"name":"anthony"}`))
+	zw.Close()
+	var deflate bytes.Buffer
+	fw := zlib.NewWriter(&deflate)
+	fw.Write([]byte(`{"name":"anthony"}`))
+	fw.Close()
+	truncated := gz.Bytes()[:gz.Len()-10]
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		code     int
+	}{
+		{"", []byte(`{"name":"anthony"}`), http.StatusOK},
+		{"gzip", gz.Bytes(), http.StatusOK},
+		{"deflate", deflate.Bytes(), http.StatusOK},
+		{"gzip", []byte("not gzip"), http.StatusBadRequest},
+		{"gzip", truncated, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/", bytes.NewReader(test.body))
+		if test.encoding != "" {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := test.code, rw.Code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.encoding, want, have)
+		}
+		if test.code == http.StatusOK && rw.Body.String() != "anthony" {
+			t.Errorf("%s: expecting anthony have %s", test.encoding, rw.Body.String())
+		}
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	w := New()
+	w.Use(RequireContentType("application/json", "application/merge-patch+json"))
+	w.Post("/", noopHandler)
+	w.Patch("/", noopHandler)
+	w.Get("/", noopHandler)
+
+	tests := []struct {
+		method      string
+		contentType string
+		code        int
+	}{
+		{"POST", "application/json", http.StatusOK},
+		{"POST", "application/json; charset=utf-8", http.StatusOK},
+		{"PATCH", "application/merge-patch+json", http.StatusOK},
+		{"POST", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"POST", "", http.StatusUnsupportedMediaType},
+		{"GET", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, "/", strings.NewReader("{}"))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := test.code, rw.Code; want != have {
+			t.Errorf("%s %s: expecting %d have %d", test.method, test.contentType, want, have)
+		}
+	}
+}
+
+func TestMiddlewareKeysDoNotCollide(t *testing.T) {
+	w := New()
+	w.Use(RequestID(), CSRF())
+	w.Get("/", func(c *Context) error {
+		c.Set("weavebox.requestID", "user")
+		c.Set("weavebox.csrf", "user")
+		return c.Text(http.StatusOK, c.RequestID()+" "+c.CSRFToken())
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "abc")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	parts := strings.Fields(rw.Body.String())
+	if len(parts) != 2 || parts[0] != "abc" || parts[1] == "user" {
+		t.Errorf("expecting the middleware values to be kept have %s", rw.Body.String())
+	}
+}
@@ -0,0 +1,228 @@
+package weavebox
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	formatKey contextKey = iota
+	pathKey
+	routeKey
+	errKey
+	csrfKey
+	requestIDKey
+)
+
+// FormatExtension returns a net/http middleware that strips a trailing format
+// extension from the request path, so /users/42.json is routed to /users/42.
+// The format is recorded on the request and takes precedence over the Accept
+// header in Context.Format and Context.Send. It must be registered with
+// UseHTTP. Without arguments the json and xml extensions are recognized.
+// The extension is only stripped when the path without it matches a route and
+// the full path does not match a route without params, so /manifest.json and
+// files served by Static keep their extension.
+// 	app.UseHTTP(weavebox.FormatExtension())
+func FormatExtension(formats ...string) func(http.Handler) http.Handler {
+	if len(formats) == 0 {
+		formats = []string{"json", "xml"}
+	}
+	known := make(map[string]bool, len(formats))
+	for _, f := range formats {
+		known[f] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ext := path.Ext(r.URL.Path)
+			if format := strings.TrimPrefix(ext, "."); known[format] {
+				r = r.WithContext(context.WithValue(r.Context(), formatKey, formatExtension{format, ext}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// formatExtension is recorded by FormatExtension, the application decides
+// whether the extension is stripped when it dispatches the request, see
+// stripFormat.
+type formatExtension struct {
+	format string
+	ext    string
+}
+
+// stripFormat strips the extension recorded by FormatExtension from the path
+// of the request when the path without it matches a route, and the path with
+// it does not match a route without params. The format is then recorded on the
+// request for Context.Format.
+func (w *Weavebox) stripFormat(r *http.Request) *http.Request {
+	f, ok := r.Context().Value(formatKey).(formatExtension)
+	if !ok {
+		return r
+	}
+	if route, ok := w.matchRoute(r.URL.Path); ok && !strings.Contains(route, ":") {
+		return r
+	}
+	stripped := strings.TrimSuffix(r.URL.Path, f.ext)
+	if _, ok := w.matchRoute(stripped); !ok {
+		return r
+	}
+	ctx := context.WithValue(r.Context(), formatKey, f.format)
+	if orig, ok := ctx.Value(pathKey).(string); ok {
+		ctx = context.WithValue(ctx, pathKey, orig[:len(orig)-len(f.ext)])
+	}
+	r = r.WithContext(ctx)
+	r.URL.Path = stripped
+	return r
+}
+
+// Format returns the response format requested by the client. A format set by
+// the FormatExtension middleware takes precedence over the Accept header,
+// which is negotiated like AcceptsType("json", "xml"). Returns "json" if no
+// supported format was requested.
+func (c *Context) Format() string {
+	if format, ok := c.request.Context().Value(formatKey).(string); ok {
+		return format
+	}
+	if format := c.AcceptsType("json", "xml"); format != "" {
+		return format
+	}
+	return "json"
+}
+
+// Send writes v in the format requested by the client, see Format.
+func (c *Context) Send(code int, v interface{}) error {
+	if c.Format() == "xml" {
+		return c.XML(code, v)
+	}
+	return c.JSON(code, v)
+}
+
+// JSONHandler adapts a handler that returns the value to respond with. The
+// value is written with status 200 by Send, so it is encoded as JSON unless
+// the client requested another format. Errors are passed to the ErrorHandler.
+// 	app.Get("/users/:id", weavebox.JSONHandler(func(c *weavebox.Context) (interface{}, error) {
+// 		return store.User(c.Param("id"))
+// 	}))
+func JSONHandler(h func(*Context) (interface{}, error)) Handler {
+	return func(c *Context) error {
+		v, err := h(c)
+		if err != nil {
+			return err
+		}
+		return c.Send(http.StatusOK, v)
+	}
+}
+
+// Accepts reports whether the client accepts the given media type, according
+// to the Accept header including its quality factors. A request without an
+// Accept header accepts any media type.
+// 	if ctx.Accepts("text/csv") {
+// 		return exportCSV(ctx)
+// 	}
+func (c *Context) Accepts(mediaType string) bool {
+	return acceptQuality(parseAccept(c.Header("Accept")), mediaType) > 0
+}
+
+// AcceptsType returns the type the client accepts best of the given types,
+// according to the Accept header including its quality factors. Types can be
+// media types or the short names json, xml, html and text. Types with equal
+// quality are preferred in the given order. An empty string is returned when
+// none of the types is acceptable.
+// 	switch ctx.AcceptsType("json", "xml") {
+// 	case "xml":
+// 		return ctx.XML(http.StatusOK, v)
+// 	case "":
+// 		return ctx.Error(http.StatusNotAcceptable, "not acceptable")
+// 	}
+// 	return ctx.JSON(http.StatusOK, v)
+func (c *Context) AcceptsType(types ...string) string {
+	ranges := parseAccept(c.Header("Accept"))
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, t := range types {
+		mediaTypes, ok := shortMediaTypes[t]
+		if !ok {
+			mediaTypes = []string{t}
+		}
+		for _, mediaType := range mediaTypes {
+			if q := acceptQuality(ranges, mediaType); q > bestQ {
+				best, bestQ = t, q
+			}
+		}
+	}
+	return best
+}
+
+// shortMediaTypes maps the short names accepted by AcceptsType to their media
+// types.
+var shortMediaTypes = map[string][]string{
+	"json": {"application/json"},
+	"xml":  {"application/xml", "text/xml"},
+	"html": {"text/html"},
+	"text": {"text/plain"},
+}
+
+// acceptRange is a media range of the Accept header with its quality.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the media ranges of an Accept header. An empty header
+// results in a single */* range.
+func parseAccept(header string) []acceptRange {
+	if strings.TrimSpace(header) == "" {
+		return []acceptRange{{"*/*", 1}}
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		r := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if r.mediaType == "" {
+			continue
+		}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific range that matches
+// the media type, or 0 if no range matches.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	mediaType = strings.ToLower(mediaType)
+	slash := strings.Index(mediaType, "/")
+	if slash < 0 {
+		return 0
+	}
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case r.mediaType == mediaType[:slash]+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,176 @@
+package weavebox
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type user struct {
+	XMLName xml.Name `json:"-" xml:"user"`
+	Name    string   `json:"name" xml:"name"`
+}
+
+func TestFormatExtension(t *testing.T) {
+	w := New()
+	w.UseHTTP(FormatExtension())
+	w.Get("/users/:id", func(c *Context) error {
+		return c.Send(http.StatusOK, user{Name: c.Param("id")})
+	})
+
+	code, body := doRequest(t, "GET", "/users/anthony.xml", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "<user><name>anthony</name></user>", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	code, body = doRequest(t, "GET", "/users/anthony.json", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "{\"name\":\"anthony\"}\n", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestFormatExtensionKeepsRoutes(t *testing.T) {
+	w := New()
+	w.CaseInsensitive = true
+	w.UseHTTP(FormatExtension())
+	w.Get("/manifest.json", func(c *Context) error {
+		return c.Text(http.StatusOK, "manifest "+c.Format())
+	})
+	w.Get("/users/:id", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("id")+" "+c.Format())
+	})
+	w.Static("/public", "./")
+
+	tests := []struct {
+		route string
+		body  string
+	}{
+		{"/manifest.json", "manifest json"},
+		{"/users/42.xml", "42 xml"},
+		{"/Users/Anthony.json", "Anthony json"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		isHTTPStatusOK(t, code)
+		if want, have := test.body, body; want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
+		}
+	}
+
+	w = New()
+	w.UseHTTP(FormatExtension("md"))
+	w.Static("/public", "./")
+	code, body := doRequest(t, "GET", "/public/README.md", nil, w)
+	isHTTPStatusOK(t, code)
+	if !strings.Contains(body, "weavebox") {
+		t.Error("expecting the static file to be served")
+	}
+}
+
+func TestContextSendAccept(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		return c.Send(http.StatusOK, user{Name: "anthony"})
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/xml")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "application/xml", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextFormatQuality(t *testing.T) {
+	w := New()
+	w.Get("/", JSONHandler(func(c *Context) (interface{}, error) {
+		return user{Name: "anthony"}, nil
+	}))
+
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"application/json, application/xml;q=0.1", "application/json"},
+		{"application/json;q=0.5, text/xml", "application/xml"},
+		{"text/html", "application/json"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.accept)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if want, have := test.contentType, rw.Header().Get("Content-Type"); !strings.HasPrefix(have, want) {
+			t.Errorf("%s: expecting %s have %s", test.accept, want, have)
+		}
+	}
+}
+
+func TestJSONHandler(t *testing.T) {
+	w := New()
+	w.UseHTTP(FormatExtension())
+	w.Get("/users/:id", JSONHandler(func(c *Context) (interface{}, error) {
+		if c.Param("id") == "nobody" {
+			return nil, c.HTTPError(http.StatusNotFound, "no such user")
+		}
+		return user{Name: c.Param("id")}, nil
+	}))
+
+	code, body := doRequest(t, "GET", "/users/anthony", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "{\"name\":\"anthony\"}\n", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	code, body = doRequest(t, "GET", "/users/anthony.xml", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "<user><name>anthony</name></user>", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	code, _ = doRequest(t, "GET", "/users/nobody", nil, w)
+	if want, have := http.StatusNotFound, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+func TestContextAccepts(t *testing.T) {
+	tests := []struct {
+		accept    string
+		mediaType string
+		accepts   bool
+		types     []string
+		best      string
+	}{
+		{"", "text/csv", true, []string{"json", "xml"}, "json"},
+		{"application/json", "application/json", true, []string{"xml", "json"}, "json"},
+		{"application/json", "text/html", false, []string{"xml", "html"}, ""},
+		{"application/json;q=0.5, application/xml", "application/json", true, []string{"json", "xml"}, "xml"},
+		{"text/xml;q=0.9, application/json;q=0.9", "text/xml", true, []string{"json", "xml"}, "json"},
+		{"text/*, text/html;q=0", "text/html", false, []string{"html", "text"}, "text"},
+		{"*/*;q=0.1, image/png", "image/png", true, []string{"application/pdf", "image/png"}, "image/png"},
+		{"Application/JSON; q=0", "application/json", false, []string{"json"}, ""},
+	}
+	for _, test := range tests {
+		w := New()
+		w.Get("/", func(c *Context) error {
+			if want, have := test.accepts, c.Accepts(test.mediaType); want != have {
+				t.Errorf("%q accepts %s: expecting %t have %t", test.accept, test.mediaType, want, have)
+			}
+			if want, have := test.best, c.AcceptsType(test.types...); want != have {
+				t.Errorf("%q %v: expecting %q have %q", test.accept, test.types, want, have)
+			}
+			return nil
+		})
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.accept)
+		w.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
@@ -0,0 +1,137 @@
+package weavebox
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps track of the token buckets used by the RateLimit
+// middleware. Implement it to share limits between multiple instances.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of the given key. It returns false
+	// and the time to wait before a token is available when the bucket is
+	// empty.
+	Take(key string, rate float64, burst int) (bool, time.Duration)
+}
+
+// RateLimitOptions configures the RateLimit middleware.
+type RateLimitOptions struct {
+	// Rate is the number of requests per second that is allowed.
+	Rate float64
+
+	// Burst is the maximum number of requests allowed at once.
+	Burst int
+
+	// KeyFunc returns the key the client is limited by. Defaults to
+	// Context.ClientIP, which only honors the forwarded headers of proxies
+	// trusted with SetTrustedProxies.
+	KeyFunc func(c *Context) string
+
+	// Store holds the token buckets. Defaults to an in-memory store.
+	Store RateLimitStore
+}
+
+// RateLimit returns a middleware that limits the requests per client with a
+// token bucket. When the limit is exceeded an HTTPError with status 429 is
+// returned and the Retry-After header is set.
+// 	app.Post("/login", loginHandler, weavebox.RateLimit(weavebox.RateLimitOptions{
+// 		Rate:  1,
+// 		Burst: 5,
+// 	}))
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = (*Context).ClientIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			ok, wait := opts.Store.Take(opts.KeyFunc(c), opts.Rate, opts.Burst)
+			if !ok {
+				retry := int(math.Ceil(wait.Seconds()))
+				c.SetHeader("Retry-After", strconv.Itoa(retry))
+				return c.HTTPError(http.StatusTooManyRequests, "too many requests")
+			}
+			return next(c)
+		}
+	}
+}
+
+// sweepInterval is the interval at which a MemoryRateLimitStore evicts the
+// buckets that have refilled completely.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  int
+}
+
+// full reports whether the bucket has refilled completely at now, in which
+// case it can be dropped, as a new bucket starts full.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= float64(b.burst)
+}
+
+// MemoryRateLimitStore is an in-memory RateLimitStore that is safe for
+// concurrent use. Buckets that have refilled completely are evicted, so the
+// store does not grow with every client ever seen.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore returns a new MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Take implements the RateLimitStore interface.
+func (s *MemoryRateLimitStore) Take(key string, rate float64, burst int) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.rate, b.burst = rate, burst
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if rate <= 0 {
+		return false, time.Hour
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// sweep evicts the buckets that have refilled completely.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.full(now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
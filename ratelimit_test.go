@@ -0,0 +1,109 @@
+package weavebox
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	w := New()
+	w.Post("/login", noopHandler, RateLimit(RateLimitOptions{Rate: 1, Burst: 2}))
+
+	do := func(ip string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = ip + ":1234"
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		return rw
+	}
+	for i := 0; i < 2; i++ {
+		isHTTPStatusOK(t, do("10.0.0.1").Code)
+	}
+	rw := do("10.0.0.1")
+	if rw.Code != http.StatusTooManyRequests {
+		t.Errorf("expecting code 429 got %d", rw.Code)
+	}
+	if want, have := "1", rw.Header().Get("Retry-After"); want != have {
+		t.Errorf("expecting Retry-After %s have %s", want, have)
+	}
+	isHTTPStatusOK(t, do("10.0.0.2").Code)
+}
+
+func TestRateLimitIgnoresForwardedHeaders(t *testing.T) {
+	w := New()
+	w.Post("/login", noopHandler, RateLimit(RateLimitOptions{Rate: 0.001, Burst: 1}))
+
+	for i := 0; i < 5; i++ {
+		r, _ := http.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", fmt.Sprintf("192.168.0.%d", i))
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := i == 0, rw.Code == http.StatusOK; want != have {
+			t.Errorf("request %d: unexpected code %d", i, rw.Code)
+		}
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	w := New()
+	if err := w.SetTrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	w.Post("/login", noopHandler, RateLimit(RateLimitOptions{Rate: 0.001, Burst: 1}))
+
+	for i, client := range []string{"1.1.1.1", "2.2.2.2", "1.1.1.1"} {
+		r, _ := http.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", client)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := i < 2, rw.Code == http.StatusOK; want != have {
+			t.Errorf("request %d from %s: unexpected code %d", i, client, rw.Code)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreRefill(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryRateLimitStore()
+	s.now = func() time.Time { return now }
+
+	if ok, _ := s.Take("a", 2, 1); !ok {
+		t.Fatal("expecting first take to succeed")
+	}
+	ok, wait := s.Take("a", 2, 1)
+	if ok {
+		t.Fatal("expecting bucket to be empty")
+	}
+	if want, have := 500*time.Millisecond, wait; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := s.Take("a", 2, 1); !ok {
+		t.Error("expecting bucket to be refilled")
+	}
+}
+
+func TestMemoryRateLimitStoreEviction(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryRateLimitStore()
+	s.now = func() time.Time { return now }
+
+	s.Take("a", 1, 2)
+	s.Take("b", 0.001, 1)
+	now = now.Add(sweepInterval)
+	s.Take("c", 1, 1)
+	if _, ok := s.buckets["a"]; ok {
+		t.Error("expecting the refilled bucket to be evicted")
+	}
+	if _, ok := s.buckets["b"]; !ok {
+		t.Error("expecting the empty bucket to be kept")
+	}
+	if want, have := 2, len(s.buckets); want != have {
+		t.Errorf("expecting %d buckets have %d", want, have)
+	}
+}
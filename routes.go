@@ -0,0 +1,152 @@
+package weavebox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method string
+	Path   string
+}
+
+// register records the route for Routes and the Allow header. It panics when
+// the route conflicts with a route registered before, that is when both have
+// the same method and the same structure, regardless of the param names.
+func (w *Weavebox) register(method, path string) {
+	for route := range w.routes {
+		if route.Method == method && routeShape(route.Path) == routeShape(path) {
+			panic(fmt.Sprintf("weavebox: route %s %s conflicts with route %s %s", method, path, route.Method, route.Path))
+		}
+	}
+	w.methods[method] = true
+	w.routes[RouteInfo{Method: method, Path: path}] = true
+}
+
+// routeShape returns the path with the names of its params removed, so
+// "/users/:id" and "/users/:userId" have the same shape.
+func routeShape(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if n := strings.IndexAny(seg, ":*"); n >= 0 {
+			segments[i] = seg[:n+1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// matchRoute returns a registered route of any method that matches the path.
+// Routes without named params, including catch-all routes, are preferred.
+func (w *Weavebox) matchRoute(p string) (string, bool) {
+	var match string
+	for route := range w.routes {
+		if fillParams(route.Path, p) != p {
+			continue
+		}
+		if !strings.Contains(route.Path, ":") {
+			return route.Path, true
+		}
+		match = route.Path
+	}
+	return match, match != ""
+}
+
+// Routes returns all routes registered on the application and its boxes,
+// sorted by path and method.
+func (w *Weavebox) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(w.routes))
+	for route := range w.routes {
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// SuggestRoute returns the path of the registered route closest to p by edit
+// distance, for use in "did you mean" messages. Parameters in the routes match
+// any value. ok is false when no route is close enough.
+// 	app.SetNotFound(func(ctx *weavebox.Context) error {
+// 		msg := "404 page not found"
+// 		if route, ok := app.SuggestRoute(ctx.Request().URL.Path); ok {
+// 			msg += ", did you mean " + route + "?"
+// 		}
+// 		return ctx.Error(http.StatusNotFound, msg)
+// 	})
+func (w *Weavebox) SuggestRoute(p string) (route string, ok bool) {
+	best := -1
+	for _, r := range w.Routes() {
+		d := levenshtein(p, fillParams(r.Path, p))
+		if best < 0 || d < best {
+			route, best = r.Path, d
+		}
+	}
+	max := len(p) / 3
+	if max < 2 {
+		max = 2
+	}
+	if best < 0 || best > max {
+		return "", false
+	}
+	return route, true
+}
+
+// fillParams replaces the parameters of the route with the segments of p at
+// the same position, so parameters do not count as a difference.
+func fillParams(route, p string) string {
+	if !strings.ContainsAny(route, ":*") {
+		return route
+	}
+	segments := strings.Split(route, "/")
+	values := strings.Split(p, "/")
+	for i, seg := range segments {
+		if len(seg) == 0 || i >= len(values) {
+			continue
+		}
+		switch seg[0] {
+		case ':':
+			segments[i] = values[i]
+		case '*':
+			segments = append(segments[:i], values[i:]...)
+			return strings.Join(segments, "/")
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,89 @@
+package weavebox
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", noopHandler)
+	w.Post("/users", noopHandler)
+	api := w.Box("/api")
+	api.Delete("/users/{id}", noopHandler)
+	w.Get("/users", noopHandler)
+
+	want := []RouteInfo{
+		{"DELETE", "/api/users/:id"},
+		{"GET", "/users"},
+		{"POST", "/users"},
+		{"GET", "/users/:id"},
+	}
+	if have := w.Routes(); !reflect.DeepEqual(want, have) {
+		t.Errorf("expecting %v have %v", want, have)
+	}
+}
+
+func TestSuggestRoute(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", noopHandler)
+	w.Get("/products", noopHandler)
+	w.Get("/orders/:id/items", noopHandler)
+
+	tests := []struct {
+		path  string
+		route string
+		ok    bool
+	}{
+		{"/user/123", "/users/:id", true},
+		{"/prodcts", "/products", true},
+		{"/orders/42/itms", "/orders/:id/items", true},
+		{"/something/completely/different", "", false},
+	}
+	for _, test := range tests {
+		route, ok := w.SuggestRoute(test.path)
+		if route != test.route || ok != test.ok {
+			t.Errorf("%s: expecting %s %v have %s %v", test.path, test.route, test.ok, route, ok)
+		}
+	}
+}
+
+func TestConflictingRoutes(t *testing.T) {
+	tests := []struct {
+		first  string
+		second string
+		panics bool
+	}{
+		{"/users/:id", "/users/:id", true},
+		{"/users/:id", "/users/:userId", true},
+		{"/files/*path", "/files/*name", true},
+		{"/users/:id", "/users/:id/posts", false},
+		{"/users/:id", "/posts/:id", false},
+	}
+	for _, test := range tests {
+		w := New()
+		w.Get(test.first, noopHandler)
+		msg := func() (msg string) {
+			defer func() {
+				if err := recover(); err != nil {
+					msg = fmt.Sprint(err)
+				}
+			}()
+			w.Box("/").Get(test.second, noopHandler)
+			return ""
+		}()
+		if want, have := test.panics, msg != ""; want != have {
+			t.Errorf("%s and %s: expecting panic %t have %t", test.first, test.second, want, have)
+			continue
+		}
+		if test.panics && !(strings.Contains(msg, test.first) && strings.Contains(msg, test.second)) {
+			t.Errorf("expecting the message to name both routes have %s", msg)
+		}
+	}
+
+	w := New()
+	w.Get("/users/:id", noopHandler)
+	w.Post("/users/:userId", noopHandler)
+}
@@ -0,0 +1,69 @@
+package weavebox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SSEMessage is a server-sent event. Only Data is required. Clients that
+// reconnect send the last received ID in the Last-Event-ID header, so the
+// stream can be resumed.
+type SSEMessage struct {
+	Event string
+	Data  string
+	ID    string
+	Retry time.Duration
+}
+
+// SendSSE writes the server-sent event to the response and flushes it to the
+// client. The event stream headers are set on the first call. An ID or Event
+// containing a line break is rejected, as it would inject extra fields into
+// the stream. Data is split in lines on CRLF, CR and LF.
+// 	for msg := range messages {
+// 		if err := c.SendSSE(msg); err != nil {
+// 			return err
+// 		}
+// 	}
+func (c *Context) SendSSE(m SSEMessage) error {
+	if strings.ContainsAny(m.ID, "\r\n") {
+		return errors.New("weavebox: sse id contains a line break")
+	}
+	if strings.ContainsAny(m.Event, "\r\n") {
+		return errors.New("weavebox: sse event contains a line break")
+	}
+
+	h := c.response.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+	}
+
+	buf := &bytes.Buffer{}
+	if m.ID != "" {
+		fmt.Fprintf(buf, "id: %s\n", m.ID)
+	}
+	if m.Event != "" {
+		fmt.Fprintf(buf, "event: %s\n", m.Event)
+	}
+	if m.Retry > 0 {
+		fmt.Fprintf(buf, "retry: %d\n", m.Retry/time.Millisecond)
+	}
+	data := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(m.Data)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+
+	if _, err := c.response.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if f, ok := c.response.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextSendSSE(t *testing.T) {
+	w := New()
+	w.Get("/events", func(c *Context) error {
+		return c.SendSSE(SSEMessage{
+			Event: "update",
+			Data:  "line1\nline2",
+			ID:    "42",
+			Retry: 3 * time.Second,
+		})
+	})
+
+	r, _ := http.NewRequest("GET", "/events", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "text/event-stream", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	want := "id: 42\nevent: update\nretry: 3000\ndata: line1\ndata: line2\n\n"
+	if have := rw.Body.String(); want != have {
+		t.Errorf("expecting %q have %q", want, have)
+	}
+	if !rw.Flushed {
+		t.Error("expecting the event to be flushed")
+	}
+}
+
+func TestContextSendSSEDataLineBreaks(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"a\r\nb", "data: a\ndata: b\n\n"},
+		{"a\rb", "data: a\ndata: b\n\n"},
+		{"a\nb", "data: a\ndata: b\n\n"},
+		{"a\r\n\rb", "data: a\ndata: \ndata: b\n\n"},
+	}
+	for _, test := range tests {
+		rw := httptest.NewRecorder()
+		ctx := &Context{response: rw}
+		if err := ctx.SendSSE(SSEMessage{Data: test.data}); err != nil {
+			t.Fatal(err)
+		}
+		if have := rw.Body.String(); test.want != have {
+			t.Errorf("expecting %q have %q", test.want, have)
+		}
+	}
+}
+
+func TestContextSendSSERejectsLineBreaks(t *testing.T) {
+	tests := []SSEMessage{
+		{ID: "1\nevent: admin", Data: "x"},
+		{ID: "1\r", Data: "x"},
+		{Event: "update\ndata: injected", Data: "x"},
+		{Event: "update\r\n", Data: "x"},
+	}
+	for _, m := range tests {
+		rw := httptest.NewRecorder()
+		ctx := &Context{response: rw}
+		if err := ctx.SendSSE(m); err == nil {
+			t.Errorf("expecting an error for %+v", m)
+		}
+		if rw.Body.Len() != 0 {
+			t.Errorf("expecting nothing written for %+v have %q", m, rw.Body.String())
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"path"
+	"sync"
 	"text/template"
 )
 
@@ -14,6 +15,9 @@ type TemplateEngine struct {
 	cache           map[string]*template.Template
 	templates       []string
 	templWithLayout map[string][]string
+
+	mu          sync.Mutex
+	layoutCache map[string]*template.Template
 }
 
 // NewTemplateEngine returns a new TemplateEngine object that will look for
@@ -23,6 +27,7 @@ func NewTemplateEngine(root string) *TemplateEngine {
 		cache:           map[string]*template.Template{},
 		templWithLayout: map[string][]string{},
 		root:            root,
+		layoutCache:     map[string]*template.Template{},
 	}
 }
 
@@ -34,6 +39,44 @@ func (t *TemplateEngine) Render(w io.Writer, name string, data interface{}) erro
 	return fmt.Errorf("template %s could not be found", name)
 }
 
+// RenderLayout renders the template within the given layout and satisfies the
+// weavebox.LayoutRenderer interface. The template is executed where the layout
+// calls {{template "content" .}}. Both are read from the root on first use and
+// cached afterwards.
+func (t *TemplateEngine) RenderLayout(w io.Writer, layout, name string, data interface{}) error {
+	templ, err := t.layoutTemplate(layout, name)
+	if err != nil {
+		return err
+	}
+	return templ.ExecuteTemplate(w, "_", data)
+}
+
+func (t *TemplateEngine) layoutTemplate(layout, name string) (*template.Template, error) {
+	key := layout + ":" + name
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if templ, exist := t.layoutCache[key]; exist {
+		return templ, nil
+	}
+	layoutSrc, err := ioutil.ReadFile(path.Join(t.root, layout))
+	if err != nil {
+		return nil, fmt.Errorf("layout %s could not be found", layout)
+	}
+	src, err := ioutil.ReadFile(path.Join(t.root, name))
+	if err != nil {
+		return nil, fmt.Errorf("template %s could not be found", name)
+	}
+	templ, err := template.New("_").Parse(string(layoutSrc))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := templ.New("content").Parse(string(src)); err != nil {
+		return nil, err
+	}
+	t.layoutCache[key] = templ
+	return templ, nil
+}
+
 // SetTemplates sets single templates that not need to be parsed with a layout
 func (t *TemplateEngine) SetTemplates(templates ...string) {
 	for _, template := range templates {
@@ -1 +1,57 @@
 package weavebox
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderLayout(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"layout.html": `<main>{{template "content" .}}</main>`,
+		"admin.html":  `<admin>{{template "content" .}}</admin>`,
+		"page.html":   `hello {{.}}`,
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := NewTemplateEngine(root)
+	engine.SetTemplates("page.html")
+	engine.Init()
+
+	w := New()
+	w.SetTemplateEngine(engine)
+	w.Get("/plain", func(c *Context) error {
+		return c.Render("page.html", "anthony")
+	})
+	box := w.Box("/site")
+	box.SetLayout("layout.html")
+	box.Get("/page", func(c *Context) error {
+		return c.Render("page.html", "anthony")
+	})
+	box.Get("/admin", func(c *Context) error {
+		return c.RenderLayout("admin.html", "page.html", "anthony")
+	})
+
+	tests := []struct {
+		route string
+		body  string
+	}{
+		{"/plain", "hello anthony"},
+		{"/site/page", "<main>hello anthony</main>"},
+		{"/site/admin", "<admin>hello anthony</admin>"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		if want, have := http.StatusOK, code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.route, want, have)
+		}
+		if want, have := test.body, body; want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
+		}
+	}
+}
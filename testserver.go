@@ -0,0 +1,108 @@
+package weavebox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+// TestServer performs requests against an application without a network
+// connection and returns the recorded responses. It is meant to be used in
+// the tests of weavebox applications.
+// 	ts := weavebox.NewTestServer(app)
+// 	rw := ts.Get("/users/1")
+// 	if rw.Code != http.StatusOK {
+// 		t.Fatalf("expecting 200 have %d", rw.Code)
+// 	}
+type TestServer struct {
+	// Header is added to each request made by the TestServer.
+	Header http.Header
+
+	handler http.Handler
+}
+
+// NewTestServer returns a TestServer that serves its requests with h,
+// commonly a *Weavebox.
+func NewTestServer(h http.Handler) *TestServer {
+	return &TestServer{
+		Header:  http.Header{},
+		handler: h,
+	}
+}
+
+// Do performs a request with the given method, target and body.
+func (s *TestServer) Do(method, target string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, body)
+	for key, values := range s.Header {
+		r.Header[key] = values
+	}
+	return s.DoRequest(r)
+}
+
+// DoRequest serves the given request and returns the recorded response.
+func (s *TestServer) DoRequest(r *http.Request) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	s.handler.ServeHTTP(rw, r)
+	return rw
+}
+
+// Get performs a GET request on the target.
+func (s *TestServer) Get(target string) *httptest.ResponseRecorder {
+	return s.Do("GET", target, nil)
+}
+
+// Head performs a HEAD request on the target.
+func (s *TestServer) Head(target string) *httptest.ResponseRecorder {
+	return s.Do("HEAD", target, nil)
+}
+
+// Delete performs a DELETE request on the target.
+func (s *TestServer) Delete(target string) *httptest.ResponseRecorder {
+	return s.Do("DELETE", target, nil)
+}
+
+// Post performs a POST request on the target with the given body.
+func (s *TestServer) Post(target string, body io.Reader) *httptest.ResponseRecorder {
+	return s.Do("POST", target, body)
+}
+
+// Put performs a PUT request on the target with the given body.
+func (s *TestServer) Put(target string, body io.Reader) *httptest.ResponseRecorder {
+	return s.Do("PUT", target, body)
+}
+
+// Patch performs a PATCH request on the target with the given body.
+func (s *TestServer) Patch(target string, body io.Reader) *httptest.ResponseRecorder {
+	return s.Do("PATCH", target, body)
+}
+
+// Dispatch runs the request through the full middleware stack and the
+// Handler of the route matching method and path, and returns the recorded
+// response. The error is the one returned by the handler chain, before it was
+// passed to the ErrorHandler, which allows unit testing a single handler. When
+// req is nil a request without a body is used, otherwise its method and URL
+// are replaced by method and path.
+// 	rw, err := app.Dispatch("GET", "/users/1", nil)
+// 	if err != nil {
+// 		t.Fatal(err)
+// 	}
+func (w *Weavebox) Dispatch(method, path string, req *http.Request) (*httptest.ResponseRecorder, error) {
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	var handlerErr error
+	r := req.WithContext(context.WithValue(req.Context(), errKey, &handlerErr))
+	r.Method = method
+	r.URL = u
+	r.RequestURI = path
+
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	return rw, handlerErr
+}
@@ -0,0 +1,81 @@
+package weavebox
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTestServer(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("id")+" "+c.Header("X-Token"))
+	})
+	w.Post("/users", func(c *Context) error {
+		var v struct{ Name string }
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusCreated, v.Name)
+	})
+
+	ts := NewTestServer(w)
+	ts.Header.Set("X-Token", "secret")
+
+	rw := ts.Get("/users/1")
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "1 secret", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	rw = ts.Post("/users", strings.NewReader(`{"name":"anthony"}`))
+	if want, have := http.StatusCreated, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "anthony", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	rw = ts.Delete("/users/1")
+	if want, have := http.StatusMethodNotAllowed, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.Header("X-Token") != "secret" {
+				return c.HTTPError(http.StatusUnauthorized, "unauthorized")
+			}
+			return next(c)
+		}
+	})
+	w.Get("/users/:id", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("id")+" "+c.Query("fields"))
+	})
+
+	rw, err := w.Dispatch("GET", "/users/1", nil)
+	if want, have := (HTTPError{http.StatusUnauthorized, "unauthorized"}), err; want != have {
+		t.Errorf("expecting %v have %v", want, have)
+	}
+	if want, have := http.StatusUnauthorized, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+
+	r, _ := http.NewRequest("POST", "/", nil)
+	r.Header.Set("X-Token", "secret")
+	rw, err = w.Dispatch("GET", "/users/1?fields=name", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "1 name", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	if _, err := w.Dispatch("GET", "users", nil); err == nil {
+		t.Error("expecting an error for an invalid path")
+	}
+}
@@ -0,0 +1,89 @@
+package weavebox
+
+import (
+	"context"
+	"time"
+)
+
+// Timeout returns a middleware that sets a deadline on the Context of the
+// request. Handlers should watch ctx.Context.Done() to abort their work.
+// When Timeout is used multiple times in a chain, the innermost one wins, so
+// a route can override the timeout of its box.
+// 	app.Use(weavebox.Timeout(5 * time.Second))
+// 	app.Get("/report", reportHandler, weavebox.Timeout(60*time.Second))
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.timeoutBase == nil {
+				c.timeoutBase = c.Context
+			}
+			deadline, cancel := context.WithTimeout(c.timeoutBase, d)
+			defer cancel()
+			c.Context = timeoutContext{Context: c.Context, deadline: deadline}
+			return next(c)
+		}
+	}
+}
+
+// SetRequestTimeout sets a deadline on the Context of every request of the
+// application and all of its boxes, like the Timeout middleware wrapping all
+// other middleware. When the deadline has passed and the Handler did not write
+// a response, an HTTPError with status 503 is passed to the ErrorHandler.
+// The deadline is only observed by code that watches ctx.Context, so a Handler
+// that ignores it still runs to completion.
+//
+// Streaming endpoints, like server-sent events or Context.Writer, that
+// legitimately run longer are canceled by the deadline as well. Give them a
+// longer Timeout, which takes precedence as the innermost one.
+// 	app.SetRequestTimeout(10 * time.Second)
+// 	app.Get("/events", eventsHandler).Timeout(time.Hour)
+func (w *Weavebox) SetRequestTimeout(d time.Duration) {
+	w.mustNotServe()
+	*w.requestTimeout = d
+}
+
+// Timeout sets a deadline on the Context of the requests handled by this
+// route, see the Timeout middleware. It takes precedence over a Timeout of
+// the box.
+// 	app.Get("/search", searchHandler).Timeout(5 * time.Second)
+func (r *Route) Timeout(d time.Duration) *Route {
+	return r.Use(Timeout(d))
+}
+
+// WithTimeout derives a Context with the given timeout from the current
+// Context and stores it on the Context. Call the returned cancel func to
+// release its resources once the bounded work is done.
+// 	cancel := ctx.WithTimeout(2 * time.Second)
+// 	defer cancel()
+// 	resp, err := client.Do(req.WithContext(ctx.Context))
+func (c *Context) WithTimeout(d time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithTimeout(c.Context, d)
+	c.Context = ctx
+	return cancel
+}
+
+// Deadline returns the time when the work done on behalf of this request
+// should be canceled. ok is false when no deadline is set.
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.Context.Deadline()
+}
+
+// timeoutContext takes its values from the embedded Context, and its deadline
+// and cancellation from deadline. This allows an inner Timeout to replace the
+// deadline of an outer Timeout without losing the values set in between.
+type timeoutContext struct {
+	context.Context
+	deadline context.Context
+}
+
+func (c timeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline.Deadline()
+}
+
+func (c timeoutContext) Done() <-chan struct{} {
+	return c.deadline.Done()
+}
+
+func (c timeoutContext) Err() error {
+	return c.deadline.Err()
+}
@@ -0,0 +1,140 @@
+package weavebox
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeoutInnermostWins(t *testing.T) {
+	checkDeadline := func(min, max time.Duration) Handler {
+		return func(c *Context) error {
+			deadline, ok := c.Context.Deadline()
+			if !ok {
+				t.Fatal("expecting a deadline")
+			}
+			if left := deadline.Sub(time.Now()); left < min || left > max {
+				t.Errorf("expecting deadline between %s and %s got %s", min, max, left)
+			}
+			if want, have := "bar", c.Get("foo"); want != have {
+				t.Errorf("expecting %s have %v", want, have)
+			}
+			return nil
+		}
+	}
+
+	w := New()
+	w.Use(Timeout(50 * time.Millisecond))
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.Set("foo", "bar")
+			return next(c)
+		}
+	})
+	w.Get("/report", checkDeadline(30*time.Second, time.Minute), Timeout(time.Minute))
+	w.Get("/", checkDeadline(0, 50*time.Millisecond))
+
+	code, _ := doRequest(t, "GET", "/report", nil, w)
+	isHTTPStatusOK(t, code)
+	code, _ = doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestTimeoutCancels(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		select {
+		case <-c.Context.Done():
+			return c.Text(http.StatusServiceUnavailable, c.Context.Err().Error())
+		case <-time.After(time.Second):
+			return nil
+		}
+	}, Timeout(10*time.Millisecond))
+
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expecting code 503 got %d", code)
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	w := New()
+	w.Use(Timeout(time.Minute))
+	w.Get("/search", func(c *Context) error {
+		deadline, ok := c.Context.Deadline()
+		if !ok {
+			t.Fatal("expecting a deadline")
+		}
+		if left := deadline.Sub(time.Now()); left > 5*time.Second {
+			t.Errorf("expecting deadline within 5s got %s", left)
+		}
+		return nil
+	}).Timeout(5 * time.Second)
+
+	code, _ := doRequest(t, "GET", "/search", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestContextWithTimeout(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		if _, ok := c.Deadline(); ok {
+			t.Error("expecting no deadline")
+		}
+		cancel := c.WithTimeout(10 * time.Millisecond)
+		defer cancel()
+		if _, ok := c.Deadline(); !ok {
+			t.Error("expecting a deadline")
+		}
+		<-c.Context.Done()
+		return c.Text(http.StatusOK, c.Context.Err().Error())
+	})
+
+	code, body := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "context deadline exceeded", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestSetRequestTimeout(t *testing.T) {
+	w := New()
+	w.SetRequestTimeout(20 * time.Millisecond)
+	api := w.Box("/api")
+	api.Get("/slow", func(c *Context) error {
+		<-c.Context.Done()
+		return c.Context.Err()
+	})
+	api.Get("/fast", func(c *Context) error {
+		return c.Text(http.StatusOK, "fast")
+	})
+	api.Get("/stream", func(c *Context) error {
+		c.Text(http.StatusOK, "started")
+		<-c.Context.Done()
+		return nil
+	})
+	api.Get("/long", func(c *Context) error {
+		select {
+		case <-c.Context.Done():
+			return c.Context.Err()
+		case <-time.After(50 * time.Millisecond):
+			return c.Text(http.StatusOK, "done")
+		}
+	}).Timeout(time.Second)
+
+	tests := []struct {
+		route string
+		code  int
+	}{
+		{"/api/slow", http.StatusServiceUnavailable},
+		{"/api/fast", http.StatusOK},
+		{"/api/stream", http.StatusOK},
+		{"/api/long", http.StatusOK},
+	}
+	for _, test := range tests {
+		code, _ := doRequest(t, "GET", test.route, nil, w)
+		if want, have := test.code, code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.route, want, have)
+		}
+	}
+}
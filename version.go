@@ -0,0 +1,39 @@
+package weavebox
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Version returns a new Box for the given API version, mounted at /version.
+// 	v1 := app.Version("v1")
+// 	v1.Get("/users", listUsers) => /v1/users
+func (w *Weavebox) Version(version string) *Box {
+	return w.Box("/" + version)
+}
+
+// Deprecate marks all routes of the box as deprecated since the given time.
+// Each response gets a Deprecation header, and a Sunset header announcing the
+// time the routes will be removed, unless sunset is zero.
+// 	app.Version("v1").Deprecate(
+// 		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+// 		time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+// 	)
+func (b *Box) Deprecate(since, sunset time.Time) *Box {
+	deprecation := "@" + strconv.FormatInt(since.Unix(), 10)
+	var sunsetValue string
+	if !sunset.IsZero() {
+		sunsetValue = sunset.UTC().Format(http.TimeFormat)
+	}
+	b.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SetHeader("Deprecation", deprecation)
+			if sunsetValue != "" {
+				c.SetHeader("Sunset", sunsetValue)
+			}
+			return next(c)
+		}
+	})
+	return b
+}
@@ -0,0 +1,39 @@
+package weavebox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVersionDeprecate(t *testing.T) {
+	w := New()
+	v1 := w.Version("v1")
+	v1.Get("/users", noopHandler)
+	v1.Deprecate(
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+	)
+	v2 := w.Version("v2")
+	v2.Get("/users", noopHandler)
+
+	r, _ := http.NewRequest("GET", "/v1/users", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "@1767225600", rw.Header().Get("Deprecation"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "Wed, 01 Jul 2026 00:00:00 GMT", rw.Header().Get("Sunset"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ = http.NewRequest("GET", "/v2/users", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if have := rw.Header().Get("Deprecation"); have != "" {
+		t.Errorf("expecting no Deprecation header have %s", have)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io"
+
+	"github.com/weavebox/weavebox"
+	"golang.org/x/net/websocket"
+)
+
+func main() {
+	app := weavebox.New()
+
+	app.Get("/echo", echoHandler)
+
+	app.Serve(3000)
+}
+
+// echoHandler upgrades the request to a WebSocket and echoes back every
+// message it receives.
+func echoHandler(c *weavebox.Context) error {
+	return c.WebSocket(func(conn *websocket.Conn) {
+		io.Copy(conn, conn)
+	})
+}
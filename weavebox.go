@@ -1,20 +1,34 @@
 package weavebox
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path"
+	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/julienschmidt/httprouter"
-	"golang.org/x/net/context"
 )
 
 // Package weavebox is opinion based minimalistic web framework for making fast and
@@ -22,8 +36,37 @@ import (
 // the fastest and most optimized request router available. Weavebox also
 // provides a gracefull webserver that can serve TLS encripted requests aswell.
 
+// ErrHandled can be returned by a Handler or Middleware to stop the chain
+// after the response has been written. The ErrorHandler is not invoked.
+var ErrHandled = errors.New("weavebox: request handled")
+
+// ErrNoResponse is passed to the ErrorHandler in strict response mode when a
+// Handler returns nil without writing a response.
+var ErrNoResponse = errors.New("weavebox: handler did not write a response")
+
 var defaultErrorHandler = func(ctx *Context, err error) {
-	http.Error(ctx.Response(), err.Error(), http.StatusInternalServerError)
+	if ctx.Written() {
+		// the response is already committed, writing the error would only
+		// append it to a partial body.
+		if err != ctx.writtenErr {
+			ctx.Log("err", err, "msg", "error after the response was written")
+		}
+		return
+	}
+	switch e := err.(type) {
+	case ValidationErrors:
+		ctx.JSON(http.StatusUnprocessableEntity, e)
+	case HTTPError:
+		ctx.weavebox.writeError(ctx.Response(), e.Description, e.Code)
+	case FieldErrors:
+		ctx.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"errors": e.FieldErrors()})
+	default:
+		msg := err.Error()
+		if ctx.weavebox.Debug {
+			msg += "\n\n" + string(ctx.Stack())
+		}
+		ctx.weavebox.writeError(ctx.Response(), msg, http.StatusInternalServerError)
+	}
 }
 
 // Weavebox first class object that is created by calling New()
@@ -41,29 +84,258 @@ type Weavebox struct {
 	// in the future. Currently browsers only supports HTTP/2 over encrypted TLS.
 	HTTP2 bool
 
+	// BodyReadTimeout limits the time Bind may spend reading the request body.
+	// Bind returns a 408 HTTPError when the body could not be read in time.
+	// Zero means no timeout.
+	BodyReadTimeout time.Duration
+
+	// NoSniff prevents content sniffing of responses. Responses written without
+	// a Content-Type get application/octet-stream and the
+	// X-Content-Type-Options: nosniff header is set.
+	NoSniff bool
+
+	// JSONErrors makes the default 404 and 405 responses and the default
+	// errorHandler respond with a JSON object like {"error":"not found"}
+	// instead of plain text.
+	JSONErrors bool
+
+	// Debug includes the stack trace in the responses of the default
+	// errorHandler. Never enable this in production.
+	Debug bool
+
+	// CaseInsensitive matches the request path in lower case against the
+	// routes, so /API/Users reaches a route registered as /api/users. Routes
+	// registered while it is set are lowered, except for their parameter
+	// names, so set it before registering routes that contain upper case
+	// letters. Handlers, including static files and http.Handlers, still see
+	// the original path and parameter values.
+	CaseInsensitive bool
+
+	// Charset is added to the Content-Type set by Text, JSON and HTML.
+	// Defaults to utf-8, set it to an empty string to leave it out.
+	Charset string
+
 	templateEngine Renderer
+	jsonEncoder    JSONEncoder
 	router         *httprouter.Router
-	middleware     []Middleware
+	middleware     []namedMiddleware
+	httpMiddleware []func(http.Handler) http.Handler
 	prefix         string
+	names          map[string]string
+	parent         *Weavebox
 	context        context.Context
 	logger         kitlog.Logger
+
+	maxMultipartMemory int64
+	notFoundHandlers   map[string]http.Handler
+	staticRoutes       map[staticRoute]httprouter.Handle
+	strictResponse     bool
+	binders            map[string]Binder
+	layout             string
+	trustedProxies     *[]*net.IPNet
+	methods            map[string]bool
+	groups             map[string][]Middleware
+	routes             map[RouteInfo]bool
+	serving            *int32
+	validator          func(interface{}) error
+	metricsObserver    MetricsObserver
+	requestTimeout     *time.Duration
+	onFinish           []func(*Context)
+}
+
+// staticRoute identifies a route without parameters, those are dispatched
+// with a map lookup before falling back to the router.
+type staticRoute struct {
+	method string
+	path   string
 }
 
 // New returns a new Weavebox object
 func New() *Weavebox {
-	return &Weavebox{
+	w := &Weavebox{
 		router:          httprouter.New(),
 		Output:          os.Stderr,
 		ErrorHandler:    defaultErrorHandler,
 		EnableAccessLog: false,
+		Charset:         "utf-8",
+		names:           map[string]string{},
 		logger:          kitlog.NewLogfmtLogger(os.Stderr),
+
+		notFoundHandlers: map[string]http.Handler{},
+		staticRoutes:     map[staticRoute]httprouter.Handle{},
+		binders:          defaultBinders(),
+		methods:          map[string]bool{},
+		groups:           map[string][]Middleware{},
+		routes:           map[RouteInfo]bool{},
+		serving:          new(int32),
+		requestTimeout:   new(time.Duration),
+		trustedProxies:   new([]*net.IPNet),
+	}
+	w.router.NotFound = http.HandlerFunc(w.notFound)
+	w.router.MethodNotAllowed = http.HandlerFunc(w.methodNotAllowed)
+	return w
+}
+
+// notFound and methodNotAllowed dispatch an HTTPError to the ErrorHandler,
+// unless they are replaced with SetNotFoundHandler and SetMethodNotAllowed.
+func (w *Weavebox) notFound(rw http.ResponseWriter, r *http.Request) {
+	restorePath(r, "", nil)
+	if h := w.lookupNotFoundHandler(r.URL.Path); h != nil {
+		h.ServeHTTP(rw, r)
+		return
+	}
+	w.notFoundError(rw, r)
+}
+
+// notFoundError passes an HTTPError with status 404 to the ErrorHandler.
+func (w *Weavebox) notFoundError(rw http.ResponseWriter, r *http.Request) {
+	ctx := w.newContext(rw, r, nil, "")
+	w.ErrorHandler(ctx, ctx.HTTPError(http.StatusNotFound, "404 page not found"))
+}
+
+// lookupNotFoundHandler returns the not found handler of the box with the
+// longest prefix that matches the path.
+func (w *Weavebox) lookupNotFoundHandler(p string) http.Handler {
+	var (
+		handler http.Handler
+		longest = -1
+	)
+	for prefix, h := range w.notFoundHandlers {
+		if len(prefix) <= longest {
+			continue
+		}
+		if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			handler, longest = h, len(prefix)
+		}
+	}
+	return handler
+}
+
+func (w *Weavebox) methodNotAllowed(rw http.ResponseWriter, r *http.Request) {
+	w.setAllow(rw, r)
+	restorePath(r, "", nil)
+	ctx := w.newContext(rw, r, nil, "")
+	w.ErrorHandler(ctx, ctx.HTTPError(http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed)))
+}
+
+// setAllow sets the Allow header to the methods of the routes matching the
+// path of the request.
+func (w *Weavebox) setAllow(rw http.ResponseWriter, r *http.Request) {
+	if allow := w.allowedMethods(r.URL.Path); len(allow) > 0 {
+		rw.Header().Set("Allow", strings.Join(allow, ", "))
+	}
+}
+
+// hasDefaultErrorHandler reports whether the ErrorHandler is not replaced.
+func (w *Weavebox) hasDefaultErrorHandler() bool {
+	return reflect.ValueOf(w.ErrorHandler).Pointer() == reflect.ValueOf(defaultErrorHandler).Pointer()
+}
+
+// contentType adds the Charset to the given media type.
+func (w *Weavebox) contentType(mediaType string) string {
+	if w == nil || w.Charset == "" {
+		return mediaType
+	}
+	return mediaType + "; charset=" + w.Charset
+}
+
+// allowedMethods returns the sorted methods of the routes matching the path.
+func (w *Weavebox) allowedMethods(p string) []string {
+	var allow []string
+	for method := range w.methods {
+		if h, _, _ := w.router.Lookup(method, p); h != nil {
+			allow = append(allow, method)
+		}
+	}
+	sort.Strings(allow)
+	return allow
+}
+
+// writeError writes the error message as plain text, or as JSON when
+// JSONErrors is enabled.
+func (w *Weavebox) writeError(rw http.ResponseWriter, msg string, code int) {
+	if !w.JSONErrors {
+		http.Error(rw, msg, code)
+		return
+	}
+	rw.Header().Set("Content-Type", w.contentType("application/json"))
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(map[string]string{"error": msg})
+}
+
+// freeze marks the application as serving, see mustNotServe.
+func (w *Weavebox) freeze() {
+	atomic.StoreInt32(w.serving, 1)
+}
+
+// mustNotServe panics when the application is already served. Routes and
+// middleware are read without locking while serving requests, so they must be
+// registered before calling one of the Serve methods. An application mounted
+// as an http.Handler is never marked as serving, registering routes after it
+// received its first request is not detected, but just as unsafe.
+func (w *Weavebox) mustNotServe() {
+	if atomic.LoadInt32(w.serving) == 1 {
+		panic("weavebox: routes and middleware must be registered before serving")
 	}
 }
 
 // Serve serves the application on the given port
 func (w *Weavebox) Serve(port int) error {
+	return w.ServeAddr(fmt.Sprintf(":%d", port))
+}
+
+// ServeAddr serves the application on the given host:port address. Use it to
+// bind to a single interface, or to a random port with ":0".
+// 	app.ServeAddr("127.0.0.1:8080")
+func (w *Weavebox) ServeAddr(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return w.ServeListener(l)
+}
+
+// ServeListener serves the application on the given listener, like a Unix
+// domain socket or a listener on a random port for testing.
+// 	l, err := net.Listen("unix", "/tmp/app.sock")
+// 	app.ServeListener(l)
+func (w *Weavebox) ServeListener(l net.Listener) error {
+	w.freeze()
+	srv := &server{
+		Server: newServer(l.Addr().String(), w, w.HTTP2),
+		quit:   make(chan struct{}, 1),
+		fquit:  make(chan struct{}, 1),
+	}
+	fmt.Fprintf(w.Output, "app listening on %s\n", l.Addr())
+	return srv.serve(l)
+}
+
+// ServeGraceful serves the application on the given port until the process
+// receives a SIGINT or SIGTERM. It then stops accepting new connections and
+// waits at most the grace period for active requests to complete.
+func (w *Weavebox) ServeGraceful(port int, grace time.Duration) error {
+	w.freeze()
 	srv := newServer(fmt.Sprintf(":%d", port), w, w.HTTP2)
-	return w.serve(srv)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(w.Output, "app listening on 0.0.0.0:%s\n", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-sig:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
 
 // ServeTLS serves the application one the given port with TLS encription.
@@ -83,6 +355,7 @@ func (w *Weavebox) ServeCustomTLS(s *http.Server, certFile, keyFile string) erro
 }
 
 func (w *Weavebox) serve(s *http.Server, files ...string) error {
+	w.freeze()
 	srv := &server{
 		Server: s,
 		quit:   make(chan struct{}, 1),
@@ -102,75 +375,391 @@ func (w *Weavebox) serve(s *http.Server, files ...string) error {
 // Handle adapts the usage of an http.Handler and will be invoked when
 // the router matches the prefix and request method
 func (w *Weavebox) Handle(method, path string, h http.Handler) {
-	w.router.Handler(method, path, h)
+	w.mustNotServe()
+	path = w.routePattern(path)
+	w.register(method, path)
+	w.router.Handle(method, path, func(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		restorePath(r, "", nil)
+		h.ServeHTTP(rw, r)
+	})
 }
 
 // Get registers a route prefix and will invoke the Handler when the route
-// matches the prefix and the request METHOD is GET
-func (w *Weavebox) Get(route string, h Handler) {
-	w.add("GET", route, h)
+// matches the prefix and the request METHOD is GET. The optional middleware
+// only applies to this route and runs after the box middleware.
+// 	app.Get("/admin", adminHandler, authMiddleware)
+func (w *Weavebox) Get(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("GET", route, h, middleware)
 }
 
 // Post registers a route prefix and will invoke the Handler when the route
 // matches the prefix and the request METHOD is POST
-func (w *Weavebox) Post(route string, h Handler) {
-	w.add("POST", route, h)
+func (w *Weavebox) Post(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("POST", route, h, middleware)
 }
 
 // Put registers a route prefix and will invoke the Handler when the route
 // matches the prefix and the request METHOD is PUT
-func (w *Weavebox) Put(route string, h Handler) {
-	w.add("PUT", route, h)
+func (w *Weavebox) Put(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("PUT", route, h, middleware)
+}
+
+// Patch registers a route prefix and will invoke the Handler when the route
+// matches the prefix and the request METHOD is PATCH
+func (w *Weavebox) Patch(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("PATCH", route, h, middleware)
 }
 
 // Delete registers a route prefix and will invoke the Handler when the route
 // matches the prefix and the request METHOD is DELETE
-func (w *Weavebox) Delete(route string, h Handler) {
-	w.add("DELETE", route, h)
+func (w *Weavebox) Delete(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("DELETE", route, h, middleware)
 }
 
 // Head registers a route prefix and will invoke the Handler when the route
 // matches the prefix and the request METHOD is HEAD
-func (w *Weavebox) Head(route string, h Handler) {
-	w.add("HEAD", route, h)
+func (w *Weavebox) Head(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("HEAD", route, h, middleware)
 }
 
 // Options registers a route prefix and will invoke the Handler when the route
 // matches the prefix and the request METHOD is OPTIONS
-func (w *Weavebox) Options(route string, h Handler) {
-	w.add("OPTIONS", route, h)
+func (w *Weavebox) Options(route string, h Handler, middleware ...Middleware) *Route {
+	return w.add("OPTIONS", route, h, middleware)
+}
+
+// Match registers the Handler for each of the given methods on the route.
+// 	app.Match([]string{"PUT", "PATCH"}, "/users/:id", updateUser)
+func (w *Weavebox) Match(methods []string, route string, h Handler, middleware ...Middleware) {
+	for _, method := range methods {
+		w.add(method, route, h, middleware)
+	}
+}
+
+// Any registers the Handler for all standard methods on the route, which is
+// useful for proxy and gateway style endpoints.
+// 	app.Any("/proxy/*path", proxyHandler)
+func (w *Weavebox) Any(route string, h Handler, middleware ...Middleware) {
+	w.Match(anyMethods, route, h, middleware...)
+}
+
+// anyMethods are the methods registered by Any.
+var anyMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// Index registers the Handler for GET and HEAD requests on the root path of
+// the box.
+func (w *Weavebox) Index(h Handler, middleware ...Middleware) {
+	w.add("GET", "/", h, middleware)
+	w.add("HEAD", "/", h, middleware)
+}
+
+// Name registers a name for the given route, so its URL can be build with
+// URL and Context.AbsoluteURL. The route will be prefixed with the prefix of
+// the box.
+// 	app.Name("user", "/users/:id")
+func (w *Weavebox) Name(name, route string) {
+	w.mustNotServe()
+	w.names[name] = convertBraces(path.Join(w.prefix, route))
+}
+
+// URL reverses the named route into a path. The params replace the named
+// parameters of the route in the order they are declared.
+// 	app.URL("user", "123") => "/users/123"
+func (w *Weavebox) URL(name string, params ...string) (string, error) {
+	route, ok := w.names[name]
+	if !ok {
+		return "", fmt.Errorf("route %s could not be found", name)
+	}
+	segments := strings.Split(route, "/")
+	n := 0
+	for i, seg := range segments {
+		if len(seg) == 0 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		if n == len(params) {
+			return "", fmt.Errorf("missing parameter %s for route %s", seg[1:], name)
+		}
+		segments[i] = strings.TrimPrefix(params[n], "/")
+		n++
+	}
+	if n != len(params) {
+		return "", fmt.Errorf("too many parameters for route %s", name)
+	}
+	return strings.Join(segments, "/"), nil
 }
 
 // Static registers the prefix to the router and start to act as a fileserver
 // 	app.Static("/public", "./assets")
 func (w *Weavebox) Static(prefix, dir string) {
-	w.router.ServeFiles(path.Join(prefix, "*filepath"), http.Dir(dir))
+	w.StaticFS(prefix, http.Dir(dir))
+}
+
+// StaticFS registers the prefix to the router and serves files from the given
+// http.FileSystem. Use http.FS to serve an embedded filesystem.
+// 	app.StaticFS("/public", http.FS(assets))
+func (w *Weavebox) StaticFS(prefix string, fs http.FileSystem) {
+	w.mustNotServe()
+	fileServer := http.FileServer(fs)
+	pattern := w.routePattern(path.Join(prefix, "*filepath"))
+	w.register("GET", pattern)
+	w.router.GET(pattern, func(rw http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		params = restorePath(r, pattern, params)
+		file := params.ByName("filepath")
+		if f, err := fs.Open(file); err == nil {
+			setFileETag(rw, f)
+			f.Close()
+		}
+		r.URL.Path = file
+		fileServer.ServeHTTP(rw, r)
+	})
+}
+
+// StaticOptions configures a static file mount, see StaticWithOptions.
+type StaticOptions struct {
+	// DisableListing responds with a 404 to requests for a directory without
+	// an index.html, instead of listing the files in the directory.
+	DisableListing bool
+}
+
+// StaticWithOptions acts like Static, configured by the given options.
+// 	app.StaticWithOptions("/public", "./public", weavebox.StaticOptions{DisableListing: true})
+func (w *Weavebox) StaticWithOptions(prefix, dir string, opts StaticOptions) {
+	var fs http.FileSystem = http.Dir(dir)
+	if opts.DisableListing {
+		fs = noListingFS{fs}
+	}
+	w.StaticFS(prefix, fs)
+}
+
+// noListingFS is an http.FileSystem that refuses to open directories that do
+// not contain an index.html, so http.FileServer can not list them.
+type noListingFS struct {
+	http.FileSystem
+}
+
+func (fs noListingFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		index, err := fs.FileSystem.Open(path.Join(name, "index.html"))
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
+
+// StaticFallback serves files from dir for the requests under prefix that did
+// not match a route, and the given fallbackFile whenever the requested file
+// could not be found. This is useful for client side routed (single page)
+// applications, which can be mounted on the root next to the routes of an
+// API. Missing files that have an extension, like .js or .css, still result in
+// a 404. Like Fallback, it replaces a not found handler set for the same
+// prefix.
+// 	app.Get("/api/users", usersHandler)
+// 	app.StaticFallback("/", "./dist", "index.html")
+func (w *Weavebox) StaticFallback(prefix, dir, fallbackFile string) {
+	w.mustNotServe()
+	prefix = strings.TrimSuffix(path.Join(w.prefix, prefix), "/")
+	fs := http.Dir(dir)
+	fileServer := http.FileServer(fs)
+	w.notFoundHandlers[prefix] = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.notFoundError(rw, r)
+			return
+		}
+		file := path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix))
+		if f, err := fs.Open(file); err == nil {
+			setFileETag(rw, f)
+			f.Close()
+			r.URL.Path = file
+			fileServer.ServeHTTP(rw, r)
+			return
+		}
+		if path.Ext(file) != "" {
+			w.notFoundError(rw, r)
+			return
+		}
+		f, err := fs.Open(fallbackFile)
+		if err != nil {
+			w.notFoundError(rw, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			w.notFoundError(rw, r)
+			return
+		}
+		setFileETag(rw, f)
+		http.ServeContent(rw, r, info.Name(), info.ModTime(), f)
+	})
 }
 
 // BindContext lets you provide a context that will live a full http roundtrip
 // BindContext is mostly used in a func main() to provide init variables that
-// may be created only once, like a database connection. If BindContext is not
-// called, weavebox will use a context.Background()
+// may be created only once, like a database connection. Values bound to a Box
+// take precedence over the values bound to its parents. The Context of each
+// request is derived from the http.Request, so it is cancelled when the client
+// goes away, the bound context only provides its values.
 func (w *Weavebox) BindContext(ctx context.Context) {
 	w.context = ctx
 }
 
+// boundContext takes its deadline and cancellation from the request context
+// and looks up values in the contexts bound with BindContext first, starting
+// with the innermost box.
+type boundContext struct {
+	context.Context
+	values []context.Context
+}
+
+func (c boundContext) Value(key interface{}) interface{} {
+	for _, ctx := range c.values {
+		if v := ctx.Value(key); v != nil {
+			return v
+		}
+	}
+	return c.Context.Value(key)
+}
+
 // Middleware is decorator pattern for wrapping weavebox.Handler functions.
+// Middleware that returns without calling next short-circuits the chain: the
+// middleware and Handler after it do not run, and a returned error is passed
+// to the ErrorHandler once. Teardown that must always run, like releasing a
+// connection acquired by the middleware, is registered with Context.OnFinish.
+// 	func withDB(next weavebox.Handler) weavebox.Handler {
+// 		return func(ctx *weavebox.Context) error {
+// 			conn := pool.Get()
+// 			ctx.OnFinish(func(*weavebox.Context) { conn.Close() })
+// 			ctx.Set(dbKey, conn)
+// 			return next(ctx)
+// 		}
+// 	}
 type Middleware func(Handler) Handler
 
 // Use appends a Handler to the box middleware. Different middleware can be set
 // for each subrouter (Box).
 func (w *Weavebox) Use(handlers ...Middleware) {
+	w.mustNotServe()
+	for _, h := range handlers {
+		w.middleware = append(w.middleware, namedMiddleware{fn: h})
+	}
+}
+
+// UseFor appends middleware that only runs for requests with one of the given
+// methods.
+// 	app.UseFor([]string{"POST", "PUT", "PATCH"}, weavebox.Decompress())
+func (w *Weavebox) UseFor(methods []string, handlers ...Middleware) {
+	for _, h := range handlers {
+		w.Use(forMethods(methods, h))
+	}
+}
+
+// forMethods wraps the Middleware so it is skipped for all other methods.
+func forMethods(methods []string, m Middleware) Middleware {
+	allowed := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+	return func(next Handler) Handler {
+		h := m(next)
+		return func(c *Context) error {
+			if allowed[c.request.Method] {
+				return h(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// UsePre inserts the given middleware in front of the middleware already
+// registered, so they will run first. A Box inherits the middleware of its
+// parent at the time Box() is called, calling UsePre on a parent afterwards
+// will not affect the box. ResetMiddleware clears these middleware as well.
+func (w *Weavebox) UsePre(handlers ...Middleware) {
+	w.mustNotServe()
+	middleware := make([]namedMiddleware, 0, len(handlers)+len(w.middleware))
 	for _, h := range handlers {
-		w.middleware = append(w.middleware, h)
+		middleware = append(middleware, namedMiddleware{fn: h})
+	}
+	w.middleware = append(middleware, w.middleware...)
+}
+
+// UseHTTP appends net/http middleware that wraps the router. In contrast to
+// Use, these run before the request is matched against the routes, so they
+// can alter the request used for routing. UseHTTP only has effect on the
+// application that serves the requests, not on a Box.
+// 	app.UseHTTP(weavebox.MethodOverride())
+func (w *Weavebox) UseHTTP(handlers ...func(http.Handler) http.Handler) {
+	w.mustNotServe()
+	w.httpMiddleware = append(w.httpMiddleware, handlers...)
+}
+
+// UseNamed appends a named Middleware to the box middleware. Boxes can exclude
+// named middleware inherited from their parent by calling Without().
+func (w *Weavebox) UseNamed(name string, h Middleware) {
+	w.mustNotServe()
+	w.middleware = append(w.middleware, namedMiddleware{name: name, fn: h})
+}
+
+// Group defines a named stack of middleware that can be used by any box of the
+// application with UseGroup.
+// 	app.Group("auth", session, requireLogin)
+// 	admin := app.Box("/admin")
+// 	admin.UseGroup("auth")
+func (w *Weavebox) Group(name string, middleware ...Middleware) {
+	w.mustNotServe()
+	w.groups[name] = middleware
+}
+
+// UseGroup appends the middleware of the group defined with Group to the box
+// middleware. The middleware are named after the group, so a Box can exclude
+// the group again with Without(). UseGroup panics if the group is not defined.
+func (w *Weavebox) UseGroup(name string) {
+	w.mustNotServe()
+	middleware, ok := w.groups[name]
+	if !ok {
+		panic(fmt.Sprintf("weavebox: middleware group %s is not defined", name))
+	}
+	for _, m := range middleware {
+		w.middleware = append(w.middleware, namedMiddleware{name: name, fn: m})
 	}
 }
 
+type namedMiddleware struct {
+	name string
+	fn   Middleware
+}
+
+// OnFinish registers a func that runs after each request of the box has
+// completed, even when the Handler returned an error or panicked. Funcs run in
+// reverse order of registration, after the funcs registered on the Context.
+// A Box inherits the funcs of its parent at the time Box() is called.
+// 	app.OnFinish(func(ctx *weavebox.Context) {
+// 		requests.WithLabelValues(strconv.Itoa(ctx.StatusCode())).Inc()
+// 	})
+func (w *Weavebox) OnFinish(fn func(*Context)) {
+	w.mustNotServe()
+	w.onFinish = append(w.onFinish, fn)
+}
+
 // Box returns a new Box that will inherit all of its parents middleware.
 // you can reset the middleware registered to the box by calling Reset()
 func (w *Weavebox) Box(prefix string) *Box {
 	b := &Box{*w}
 	b.Weavebox.prefix += prefix
+	b.Weavebox.parent = w
+	b.Weavebox.context = nil
 	return b
 }
 
@@ -185,22 +774,182 @@ func (b *Box) ResetMiddleware() *Box {
 	return b
 }
 
+// Without removes the middleware registered with the given name from the box.
+// Middleware of the parent is not affected.
+func (b *Box) Without(name string) *Box {
+	middleware := make([]namedMiddleware, 0, len(b.Weavebox.middleware))
+	for _, m := range b.Weavebox.middleware {
+		if m.name != name {
+			middleware = append(middleware, m)
+		}
+	}
+	b.Weavebox.middleware = middleware
+	return b
+}
+
 // SetTemplateEngine allows the use of any template engine out there, if it
 // satisfies the Renderer interface
 func (w *Weavebox) SetTemplateEngine(t Renderer) {
 	w.templateEngine = t
 }
 
+// SetLayout sets the layout that Context.Render renders each template in. The
+// template engine must implement the LayoutRenderer interface. A Box can set
+// its own layout, an empty name disables the layout.
+func (w *Weavebox) SetLayout(name string) {
+	w.layout = name
+}
+
+// JSONEncoder writes the JSON encoding of v to w.
+type JSONEncoder func(w io.Writer, v interface{}) error
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// SetJSONEncoder sets the encoder used by Context.JSON. Like the other
+// settings, a Box inherits the encoder when it is created.
+// 	app.SetJSONEncoder(func(w io.Writer, v interface{}) error {
+// 		enc := json.NewEncoder(w)
+// 		enc.SetEscapeHTML(false)
+// 		return enc.Encode(v)
+// 	})
+func (w *Weavebox) SetJSONEncoder(enc JSONEncoder) {
+	w.jsonEncoder = enc
+}
+
+const defaultMaxMultipartMemory = 32 << 20 // 32 MB
+
+// SetMaxMultipartMemory sets the maximum number of bytes of the file parts of
+// a multipart form that are kept in memory, the remainder is stored in
+// temporary files on disk. Defaults to 32 MB.
+func (w *Weavebox) SetMaxMultipartMemory(bytes int64) {
+	w.maxMultipartMemory = bytes
+}
+
+// SetStrictResponse enables or disables strict response mode. In strict mode a
+// Handler that returns nil without writing a response is logged and
+// ErrNoResponse is passed to the ErrorHandler, instead of silently responding
+// with an empty 200. Disabled by default.
+func (w *Weavebox) SetStrictResponse(strict bool) {
+	w.strictResponse = strict
+}
+
+// SetTrustedProxies enables the forwarded headers used by ClientIP, BaseURL
+// and friends for requests coming from the given proxies. Proxies are given as
+// an IP address or a CIDR network. By default the forwarded headers are
+// ignored, as any client can set them. The proxies apply to all boxes.
+// 	app.SetTrustedProxies("10.0.0.0/8", "127.0.0.1")
+func (w *Weavebox) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, n)
+	}
+	*w.trustedProxies = nets
+	return nil
+}
+
+// SetCleanPath enables or disables the redirects of the router to the cleaned
+// path, like /foo//bar/../baz to /foo/baz, and to the path with or without
+// the trailing slash. Enabled by default. Disable it when the exact path
+// matters, like for signed urls or base64 encoded parameters.
+//
+// Without cleaning, requests with unusual paths simply do not match a route.
+// Handlers that use the raw path, for example to open files, must sanitize it
+// themselves, and net/http middleware that guards paths by their prefix will
+// see paths like //admin that it may not expect.
+func (w *Weavebox) SetCleanPath(clean bool) {
+	w.router.RedirectFixedPath = clean
+	w.router.RedirectTrailingSlash = clean
+}
+
+// MetricsObserver is called at the end of each request with the method, the
+// pattern of the matched route, the status code and the duration of the
+// request. The pattern is empty when no route matched.
+type MetricsObserver func(method, routePattern string, status int, dur time.Duration)
+
+// SetMetricsObserver sets the MetricsObserver of the application, which is the
+// place to record request metrics, for example in a Prometheus histogram.
+// 	app.SetMetricsObserver(func(method, route string, status int, dur time.Duration) {
+// 		duration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(dur.Seconds())
+// 	})
+func (w *Weavebox) SetMetricsObserver(o MetricsObserver) {
+	w.mustNotServe()
+	w.metricsObserver = o
+}
+
+// SetLogger sets the logger used by Context.Log and Context.Logger, and for
+// logging recovered panics. Defaults to a logfmt logger writing to stderr.
+func (w *Weavebox) SetLogger(l kitlog.Logger) {
+	w.logger = l
+}
+
 // SetNotFoundHandler sets a custom handler that is invoked whenever the
-// router could not match a route against the request url.
+// router could not match a route against the request url. By default an
+// HTTPError with status 404 is passed to the ErrorHandler. When set on a Box,
+// the handler only applies to unmatched paths under the prefix of the box.
 func (w *Weavebox) SetNotFoundHandler(h http.Handler) {
-	w.router.NotFound = h
+	w.mustNotServe()
+	w.notFoundHandlers[w.prefix] = h
+}
+
+// Fallback registers a Handler that is invoked for all requests that did not
+// match a route, instead of responding with a 404. In contrast to
+// SetNotFoundHandler the Handler runs trough the middleware of the box. When
+// set on a Box, it only applies to unmatched paths under the prefix of the box.
+// Fallback replaces a not found handler set on the same box.
+// 	app.Fallback(func(ctx *weavebox.Context) error {
+// 		proxy.ServeHTTP(ctx.Response(), ctx.Request())
+// 		return nil
+// 	})
+func (w *Weavebox) Fallback(h Handler) {
+	w.mustNotServe()
+	handle := w.makeHTTPRouterHandle(&Route{weavebox: w, handler: h})
+	w.notFoundHandlers[w.prefix] = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		handle(rw, r, nil)
+	})
+}
+
+// SetNotFound sets a Handler that is invoked whenever the router could not
+// match a route against the request url. Like Fallback the Handler runs trough
+// the middleware of the box, so not found responses are logged and tagged
+// like any other response. When the Handler returns without writing a
+// response, an HTTPError with status 404 is passed to the ErrorHandler.
+// 	app.SetNotFound(func(ctx *weavebox.Context) error {
+// 		return ctx.Render("404.html", nil)
+// 	})
+func (w *Weavebox) SetNotFound(h Handler) {
+	w.Fallback(func(c *Context) error {
+		if err := h(c); err != nil || c.Written() {
+			return err
+		}
+		return c.HTTPError(http.StatusNotFound, "404 page not found")
+	})
 }
 
 // SetMethodNotAllowed sets a custom handler that is invoked whenever the router
-// could not match the method against the predefined routes.
+// could not match the method against the predefined routes. By default an
+// HTTPError with status 405 is passed to the ErrorHandler. The Allow header of
+// the response already lists the methods registered for the path, so the
+// handler can read it with rw.Header().Get("Allow").
 func (w *Weavebox) SetMethodNotAllowed(h http.Handler) {
-	w.router.MethodNotAllowed = h
+	w.mustNotServe()
+	w.router.MethodNotAllowed = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w.setAllow(rw, r)
+		restorePath(r, "", nil)
+		h.ServeHTTP(rw, r)
+	})
 }
 
 // SetErrorHandler sets a centralized errorHandler that is invoked whenever
@@ -209,60 +958,282 @@ func (w *Weavebox) SetErrorHandler(h ErrorHandlerFunc) {
 	w.ErrorHandler = h
 }
 
-// ServeHTTP satisfies the http.Handler interface
+// ServeHTTP satisfies the http.Handler interface, so weavebox can be wrapped by
+// any net/http middleware or mounted on a http.ServeMux. When mounted under a
+// prefix, strip it with http.StripPrefix so routes can be registered without
+// it. All routes and middleware must be registered before the first request,
+// unlike the Serve methods ServeHTTP can not detect late registrations.
+// 	mux.Handle("/api/", http.StripPrefix("/api", app))
 func (w *Weavebox) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	if rw != nil {
 		rw.Header().Set("Server", "weavebox/1.0")
 	}
-	if w.EnableAccessLog {
+	var h http.Handler = http.HandlerFunc(w.dispatch)
+	for i := len(w.httpMiddleware) - 1; i >= 0; i-- {
+		h = w.httpMiddleware[i](h)
+	}
+	if w.EnableAccessLog || w.metricsObserver != nil {
 		start := time.Now()
 		logger := &responseLogger{w: rw}
-		w.router.ServeHTTP(logger, r)
-		w.writeLog(r, start, logger.Status(), logger.Size())
+		var route string
+		if w.metricsObserver != nil {
+			r = r.WithContext(context.WithValue(r.Context(), routeKey, &route))
+		}
+		h.ServeHTTP(logger, r)
+		if w.EnableAccessLog {
+			w.writeLog(r, start, logger.Status(), logger.Size())
+		}
+		if w.metricsObserver != nil {
+			status := logger.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			w.metricsObserver(r.Method, route, status, time.Since(start))
+		}
 		// saves an allocation by seperating the whole logger if log is disabled
 	} else {
-		w.router.ServeHTTP(rw, r)
+		h.ServeHTTP(rw, r)
+	}
+}
+
+// dispatch serves routes without parameters with a single map lookup, all
+// other requests are matched by the router.
+func (w *Weavebox) dispatch(rw http.ResponseWriter, r *http.Request) {
+	if w.CaseInsensitive {
+		if lower := lowerASCII(r.URL.Path); lower != r.URL.Path {
+			r = r.WithContext(context.WithValue(r.Context(), pathKey, r.URL.Path))
+			r.URL.Path = lower
+		}
+	}
+	r = w.stripFormat(r)
+	if handle, ok := w.staticRoutes[staticRoute{r.Method, r.URL.Path}]; ok {
+		handle(rw, r, nil)
+		return
+	}
+	w.router.ServeHTTP(rw, r)
+}
+
+// routePattern returns the pattern as it is registered to the router. When
+// CaseInsensitive is set, all but the parameter names are lowered, so the
+// route matches the lowered request path.
+func (w *Weavebox) routePattern(pattern string) string {
+	if !w.CaseInsensitive {
+		return pattern
+	}
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if n := strings.IndexAny(seg, ":*"); n >= 0 {
+			segments[i] = lowerASCII(seg[:n]) + seg[n:]
+		} else {
+			segments[i] = lowerASCII(seg)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// lowerASCII lowers the ASCII letters of s only, so the byte offsets of the
+// path segments stay the same.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// restorePath restores the original path of a request that was lowered for
+// case insensitive matching, and takes the values of the params of the route
+// from the original path.
+func restorePath(r *http.Request, route string, params httprouter.Params) httprouter.Params {
+	orig, ok := r.Context().Value(pathKey).(string)
+	if !ok {
+		return params
+	}
+	r.URL.Path = orig
+	if len(params) == 0 {
+		return params
+	}
+	restored := make(httprouter.Params, 0, len(params))
+	segments := strings.Split(orig, "/")
+	for i, seg := range strings.Split(route, "/") {
+		n := strings.IndexAny(seg, ":*")
+		if n < 0 || i >= len(segments) || n > len(segments[i]) {
+			continue
+		}
+		value := segments[i][n:]
+		if seg[n] == '*' {
+			value = "/" + strings.Join(segments[i:], "/")[n:]
+		}
+		restored = append(restored, httprouter.Param{Key: seg[n+1:], Value: value})
+	}
+	return restored
+}
+
+func (w *Weavebox) add(method, pattern string, h Handler, middleware []Middleware) *Route {
+	w.mustNotServe()
+	route := &Route{
+		weavebox:   w,
+		path:       w.routePattern(convertBraces(path.Join(w.prefix, pattern))),
+		handler:    h,
+		middleware: middleware,
+	}
+	w.register(method, route.path)
+	handle := w.makeHTTPRouterHandle(route)
+	w.router.Handle(method, route.path, handle)
+	if !strings.ContainsAny(route.path, ":*") {
+		w.staticRoutes[staticRoute{method, route.path}] = handle
+	}
+	return route
+}
+
+// Route is returned when registering a Handler and can be used to name the
+// route or to attach middleware to it.
+// 	app.Get("/users/:id", userHandler).Name("user").Use(authMiddleware)
+type Route struct {
+	weavebox    *Weavebox
+	path        string
+	handler     Handler
+	middleware  []Middleware
+	constraints []paramConstraint
+}
+
+// Name registers a name for the route, see Weavebox.Name.
+func (r *Route) Name(name string) *Route {
+	r.weavebox.mustNotServe()
+	r.weavebox.names[name] = r.path
+	return r
+}
+
+// Use appends middleware that only applies to this route. It runs after the
+// box middleware.
+func (r *Route) Use(middleware ...Middleware) *Route {
+	r.weavebox.mustNotServe()
+	r.middleware = append(r.middleware, middleware...)
+	return r
+}
+
+// convertBraces rewrites brace style parameters into the colon style the
+// router understands, so "/users/{id}" becomes "/users/:id".
+func convertBraces(route string) string {
+	if !strings.Contains(route, "{") {
+		return route
+	}
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		if len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}' {
+			segments[i] = ":" + seg[1:len(seg)-1]
+		}
 	}
+	return strings.Join(segments, "/")
 }
 
-func (w *Weavebox) add(method, route string, h Handler) {
-	path := path.Join(w.prefix, route)
-	w.router.Handle(method, path, w.makeHTTPRouterHandle(h))
+func (w *Weavebox) newContext(rw http.ResponseWriter, r *http.Request, params httprouter.Params, route string) *Context {
+	var reqCtx context.Context = r.Context()
+	var values []context.Context
+	for b := w; b != nil; b = b.parent {
+		if b.context != nil {
+			values = append(values, b.context)
+		}
+	}
+	if len(values) > 0 {
+		reqCtx = boundContext{Context: reqCtx, values: values}
+	}
+	if w.NoSniff {
+		rw = &noSniffWriter{ResponseWriter: rw}
+	}
+	return &Context{
+		Context:  reqCtx,
+		vars:     params,
+		route:    route,
+		response: &responseLogger{w: rw},
+		request:  r,
+		weavebox: w,
+	}
 }
 
-func (w *Weavebox) makeHTTPRouterHandle(h Handler) httprouter.Handle {
+func (w *Weavebox) makeHTTPRouterHandle(route *Route) httprouter.Handle {
 	return func(rw http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		if w.context == nil {
-			w.context = context.Background()
+		if p, ok := r.Context().Value(routeKey).(*string); ok {
+			*p = route.path
+		}
+		params = restorePath(r, route.path, params)
+		constraint, failed := route.failedConstraint(params)
+		if failed && !constraint.badRequest {
+			if p, ok := r.Context().Value(routeKey).(*string); ok {
+				*p = ""
+			}
+			w.notFound(rw, r)
+			return
 		}
-		ctx := &Context{
-			Context:  w.context,
-			vars:     params,
-			response: rw,
-			request:  r,
-			weavebox: w,
+		ctx := w.newContext(rw, r, params, route.path)
+		defer ctx.finish(w.onFinish)
+		if failed {
+			w.ErrorHandler(ctx, constraint.httpError(ctx))
+			return
 		}
 
 		defer func() {
 			if err := recover(); err != nil {
-				trace := make([]byte, 256)
+				trace := make([]byte, 4096)
 				n := runtime.Stack(trace, true)
-				w.logger.Log("recoverd", err, "stacktrace", string(trace[:n]))
-				w.ErrorHandler(ctx, fmt.Errorf("%v", err))
+				ctx.stack = trace[:n]
+				ctx.endBuffer(false)
+				w.logger.Log("recoverd", err, "stacktrace", string(ctx.stack))
+				err := fmt.Errorf("%v", err)
+				recordError(r, err)
+				w.ErrorHandler(ctx, err)
 				return
 			}
 		}()
 
+		h := route.handler
+		for i := len(route.middleware) - 1; i >= 0; i-- {
+			h = route.middleware[i](unlessAborted(h))
+		}
 		for i := len(w.middleware) - 1; i >= 0; i-- {
-			h = w.middleware[i](h)
+			h = w.middleware[i].fn(unlessAborted(h))
+		}
+		timeout := *w.requestTimeout
+		if timeout > 0 {
+			h = Timeout(timeout)(h)
 		}
-		if err := h(ctx); err != nil {
+		err := h(ctx)
+		if timeout > 0 && ctx.Context.Err() == context.DeadlineExceeded && !ctx.Written() {
+			err = ctx.HTTPError(http.StatusServiceUnavailable, "request timeout")
+		}
+		if err == nil && w.strictResponse && !ctx.Written() {
+			w.logger.Log("route", route.path, "err", ErrNoResponse)
+			err = ErrNoResponse
+		}
+		recordError(r, err)
+		ctx.endBuffer(err == nil || err == ErrHandled)
+		if err != nil && err != ErrHandled {
 			w.ErrorHandler(ctx, err)
 			return
 		}
 	}
 }
 
+// recordError stores the error of the handler chain for Dispatch.
+func recordError(r *http.Request, err error) {
+	if p, ok := r.Context().Value(errKey).(*error); ok {
+		*p = err
+	}
+}
+
+// unlessAborted returns a Handler that only calls h if the Context has not
+// been aborted.
+func unlessAborted(h Handler) Handler {
+	return func(c *Context) error {
+		if c.aborted {
+			return nil
+		}
+		return h(c)
+	}
+}
+
 func (w *Weavebox) writeLog(r *http.Request, start time.Time, status, size int) {
 	host, _, _ := net.SplitHostPort(r.Host)
 	username := "-"
@@ -295,12 +1266,23 @@ type ErrorHandlerFunc func(ctx *Context, err error)
 type Context struct {
 	// Context is a idiomatic way to pass information between requests.
 	// More information about context.Context can be found here:
-	// https://godoc.org/golang.org/x/net/context
+	// https://golang.org/pkg/context
 	Context  context.Context
 	response http.ResponseWriter
 	request  *http.Request
 	vars     httprouter.Params
+	route    string
+	query    url.Values
+	stack    []byte
+	store    map[interface{}]interface{}
 	weavebox *Weavebox
+
+	timeoutBase context.Context
+	buffer      *bufferedResponse
+	onFinish    []func(*Context)
+	writtenErr  error
+	body        []byte
+	aborted     bool
 }
 
 // Response returns a default http.ResponseWriter
@@ -308,36 +1290,302 @@ func (c *Context) Response() http.ResponseWriter {
 	return c.response
 }
 
+// StatusCode returns the status code written to the response, or 0 if the
+// header has not been written yet. Middleware can inspect it after calling
+// the next Handler.
+func (c *Context) StatusCode() int {
+	if l, ok := c.response.(*responseLogger); ok {
+		return l.Status()
+	}
+	return 0
+}
+
+// OnFinish registers a func that runs after the request has completed, even
+// when the Handler returned an error or panicked. Funcs run in reverse order of
+// registration.
+func (c *Context) OnFinish(fn func(*Context)) {
+	c.onFinish = append(c.onFinish, fn)
+}
+
+// finish runs the funcs registered on the Context, followed by the given funcs
+// of the box, both in reverse order.
+func (c *Context) finish(boxFuncs []func(*Context)) {
+	for i := len(c.onFinish) - 1; i >= 0; i-- {
+		c.onFinish[i](c)
+	}
+	for i := len(boxFuncs) - 1; i >= 0; i-- {
+		boxFuncs[i](c)
+	}
+}
+
+// Abort stops the middleware chain without an error, the middleware and
+// Handler after the current one are not called. Use it when the request is
+// handled, for example on a cache hit.
+// 	if data, ok := cache.Get(ctx.Request().URL.Path); ok {
+// 		ctx.Abort()
+// 		return ctx.JSON(http.StatusOK, data)
+// 	}
+// 	return next(ctx)
+func (c *Context) Abort() {
+	c.aborted = true
+}
+
+// IsAborted reports whether Abort has been called.
+func (c *Context) IsAborted() bool {
+	return c.aborted
+}
+
+// Written reports whether the status header of the response has been written,
+// either explicitly or by writing to the body.
+func (c *Context) Written() bool {
+	return c.StatusCode() != 0
+}
+
+// BytesWritten returns the number of bytes written to the response body.
+func (c *Context) BytesWritten() int {
+	if l, ok := c.response.(*responseLogger); ok {
+		return l.Size()
+	}
+	return 0
+}
+
 // Request returns a default http.Request ptr
 func (c *Context) Request() *http.Request {
 	return c.request
 }
 
 // JSON is a helper function for writing a JSON encoded representation of v to
-// the ResponseWriter.
+// the ResponseWriter. Nothing is written if v could not be encoded, so the
+// returned error can still be handled by the errorHandler.
 func (c *Context) JSON(code int, v interface{}) error {
-	c.Response().Header().Set("Content-Type", "application/json")
+	encode := c.weavebox.jsonEncoder
+	if encode == nil {
+		encode = encodeJSON
+	}
+	buf := &bytes.Buffer{}
+	if err := encode(buf, v); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Type", c.weavebox.contentType("application/json"))
+	c.Response().WriteHeader(code)
+	_, err := buf.WriteTo(c.Response())
+	return err
+}
+
+// XML is a helper function for writing an XML encoded representation of v to
+// the ResponseWriter. Like JSON, nothing is written if v could not be encoded.
+func (c *Context) XML(code int, v interface{}) error {
+	buf := &bytes.Buffer{}
+	if err := xml.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Type", "application/xml")
 	c.Response().WriteHeader(code)
-	return json.NewEncoder(c.Response()).Encode(v)
+	_, err := buf.WriteTo(c.Response())
+	return err
+}
+
+// StopJSON writes the JSON encoded representation of v to the ResponseWriter
+// and returns ErrHandled. Middleware can return its result to stop the chain.
+// 	if token == "" {
+// 		return c.StopJSON(http.StatusUnauthorized, errResp)
+// 	}
+func (c *Context) StopJSON(code int, v interface{}) error {
+	if err := c.JSON(code, v); err != nil {
+		return err
+	}
+	return ErrHandled
 }
 
 // Text is a helper function for writing a text/plain string to the ResponseWriter
 func (c *Context) Text(code int, text string) error {
-	c.Response().Header().Set("Content-Type", "text/plain")
+	c.Response().Header().Set("Content-Type", c.weavebox.contentType("text/plain"))
 	c.Response().WriteHeader(code)
 	c.Response().Write([]byte(text))
 	return nil
 }
 
+// HTML is a helper function for writing an HTML string to the ResponseWriter
+func (c *Context) HTML(code int, html string) error {
+	c.Response().Header().Set("Content-Type", c.weavebox.contentType("text/html"))
+	c.Response().WriteHeader(code)
+	_, err := c.Response().Write([]byte(html))
+	return err
+}
+
+// Blob writes the bytes to the response with the given Content-Type, and sets
+// the Content-Length. An empty contentType results in application/octet-stream.
+// 	return c.Blob(http.StatusOK, "application/pdf", pdf)
+func (c *Context) Blob(code int, contentType string, b []byte) error {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := c.Response().Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	c.Response().WriteHeader(code)
+	_, err := c.Response().Write(b)
+	return err
+}
+
 // DecodeJSON is a helper that decodes the request Body to v.
 // For a more in depth use of decoding and encoding JSON, use the std JSON package.
 func (c *Context) DecodeJSON(v interface{}) error {
 	return json.NewDecoder(c.Request().Body).Decode(v)
 }
 
-// Render calls the templateEngines Render function
+// Bind decodes the request body to v with the Binder registered for the
+// Content-Type of the request, JSON is assumed when no Binder matches. Form
+// values are mapped using the form struct tag. For GET and HEAD requests the
+// url query parameters are bound with BindQuery instead. If BodyReadTimeout is
+// set and the body could not be read in time, an HTTPError with status 408 is
+// returned. The bound value is validated with the validator set with
+// SetValidator.
+func (c *Context) Bind(v interface{}) error {
+	var err error
+	if c.request.Method == "GET" || c.request.Method == "HEAD" {
+		err = c.BindQuery(v)
+	} else {
+		err = c.lookupBinder()(c, v)
+	}
+	if err != nil {
+		return err
+	}
+	return c.validate(v)
+}
+
+// MustBind binds the request to v like Bind. If binding fails, the error is
+// written to the response trough the ErrorHandler and false is returned. The
+// handler should not write to the response after that.
+// 	if !c.MustBind(&req) {
+// 		return nil
+// 	}
+func (c *Context) MustBind(v interface{}) bool {
+	if err := c.Bind(v); err != nil {
+		c.weavebox.ErrorHandler(c, err)
+		return false
+	}
+	return true
+}
+
+// BindQuery maps the url query parameters on the fields of the struct v points
+// to, using the query struct tag. Repeated keys can be bound to slices. An
+// HTTPError with status 400 is returned if a value could not be converted.
+// 	type filter struct {
+// 		Tags  []string `query:"tag"`
+// 		Limit int      `query:"limit"`
+// 	}
+func (c *Context) BindQuery(v interface{}) error {
+	if err := bindValues(v, c.QueryValues(), "query"); err != nil {
+		return c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// BindParams maps the named url parameters on the fields of the struct v points
+// to, using the param struct tag. An HTTPError with status 400 is returned if
+// a value could not be converted.
+// 	app.Get("/users/:id/posts/:postId", ..)
+// 	type req struct {
+// 		ID     int `param:"id"`
+// 		PostID int `param:"postId"`
+// 	}
+func (c *Context) BindParams(v interface{}) error {
+	values := make(url.Values, len(c.vars))
+	for _, p := range c.vars {
+		values.Set(p.Key, p.Value)
+	}
+	if err := bindValues(v, values, "param"); err != nil {
+		return c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// Body reads and returns the raw request body. The body is cached, so
+// subsequent calls return the same bytes, and the request body is replaced so
+// Bind and Form can still read it. This is useful to verify the signature of a
+// webhook payload before binding it. BodyReadTimeout applies as with Bind.
+func (c *Context) Body() ([]byte, error) {
+	if c.body != nil {
+		return c.body, nil
+	}
+	body, err := c.readBody()
+	if err != nil {
+		return nil, err
+	}
+	c.body = body
+	c.request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func (c *Context) readBody() ([]byte, error) {
+	timeout := c.weavebox.BodyReadTimeout
+	if timeout == 0 {
+		return ioutil.ReadAll(c.request.Body)
+	}
+
+	type result struct {
+		body []byte
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		body, err := ioutil.ReadAll(c.request.Body)
+		resc <- result{body, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-resc:
+		return res.body, res.err
+	case <-timer.C:
+		// Closing the body blocks while the read is in progress, so expire the
+		// read deadline of the connection to unblock it instead. Writers that
+		// do not support deadlines get the body closed in the background.
+		rc := http.NewResponseController(c.response)
+		if err := rc.SetReadDeadline(time.Now()); err == nil {
+			<-resc
+		} else {
+			go c.request.Body.Close()
+		}
+		return nil, c.HTTPError(http.StatusRequestTimeout, "request body read timeout")
+	}
+}
+
+// Render calls the templateEngines Render function. When a layout is set with
+// SetLayout the template is rendered within that layout. When the CSRF
+// middleware is used and data is a map[string]interface{} or nil, the current
+// token is available in the template as {{.csrfToken}}.
 func (c *Context) Render(name string, data interface{}) error {
-	return c.weavebox.templateEngine.Render(c.Response(), name, data)
+	return c.RenderLayout(c.weavebox.layout, name, data)
+}
+
+// RenderLayout renders the template within the given layout, overriding the
+// layout set with SetLayout. An empty layout renders the template on its own.
+// 	ctx.RenderLayout("admin.html", "users.html", data)
+func (c *Context) RenderLayout(layout, name string, data interface{}) error {
+	if token := c.CSRFToken(); token != "" {
+		switch d := data.(type) {
+		case nil:
+			data = map[string]interface{}{"csrfToken": token}
+		case map[string]interface{}:
+			merged := make(map[string]interface{}, len(d)+1)
+			for k, v := range d {
+				merged[k] = v
+			}
+			merged["csrfToken"] = token
+			data = merged
+		}
+	}
+	if layout == "" {
+		return c.weavebox.templateEngine.Render(c.Response(), name, data)
+	}
+	r, ok := c.weavebox.templateEngine.(LayoutRenderer)
+	if !ok {
+		return errors.New("weavebox: template engine does not support layouts")
+	}
+	return r.RenderLayout(c.Response(), layout, name, data)
 }
 
 // Param returns the url named parameter given in the route prefix by its name
@@ -346,22 +1594,273 @@ func (c *Context) Param(name string) string {
 	return c.vars.ByName(name)
 }
 
+// ParamInt returns the named parameter as an int. When the parameter is not
+// an integer an HTTPError with status 400 naming the parameter is returned.
+// 	id, err := ctx.ParamInt("id")
+// 	if err != nil {
+// 		return err
+// 	}
+func (c *Context) ParamInt(name string) (int, error) {
+	n, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, c.HTTPError(http.StatusBadRequest, fmt.Sprintf("parameter %s must be an integer", name))
+	}
+	return n, nil
+}
+
+// Params returns all named parameters of the matched route.
+// 	app.Get("/:user/:repo", ..) => ctx.Params() == map[user:anthdm repo:weavebox]
+func (c *Context) Params() map[string]string {
+	params := make(map[string]string, len(c.vars))
+	for _, p := range c.vars {
+		params[p.Key] = p.Value
+	}
+	return params
+}
+
+// RoutePattern returns the registered route pattern, including any Box prefix,
+// that matched the current request.
+// 	app.Get("/users/:id", ..) => ctx.RoutePattern() == "/users/:id"
+func (c *Context) RoutePattern() string {
+	return c.route
+}
+
+// Path returns the absolute path of the request.
+func (c *Context) Path() string {
+	return c.request.URL.Path
+}
+
+// BoxPath returns the path of the request relative to the prefix of the box
+// the route is registered on, which allows middleware to be reused under
+// different prefixes. The prefix is stripped by its number of segments, so
+// params in the prefix match any value.
+// 	admin := app.Box("/admin")
+// 	GET /admin/users => ctx.Path() == "/admin/users", ctx.BoxPath() == "/users"
+// 	org := app.Box("/orgs/:org")
+// 	GET /orgs/acme/users => ctx.BoxPath() == "/users"
+func (c *Context) BoxPath() string {
+	p := c.Path()
+	prefix := strings.Trim(path.Clean("/"+c.weavebox.prefix), "/")
+	if prefix == "" || p == "" {
+		return p
+	}
+	for i := strings.Count(prefix, "/") + 1; i > 0; i-- {
+		n := strings.Index(p[1:], "/")
+		if n < 0 {
+			return "/"
+		}
+		p = p[n+1:]
+	}
+	return p
+}
+
+// AbsoluteURL reverses the named route and prefixes it with the BaseURL of the
+// current request.
+func (c *Context) AbsoluteURL(name string, params ...string) (string, error) {
+	p, err := c.weavebox.URL(name, params...)
+	if err != nil {
+		return "", err
+	}
+	return c.BaseURL() + p, nil
+}
+
+// BaseURL returns the scheme and host of the current request, like
+// "https://example.com". The X-Forwarded-Proto and X-Forwarded-Host headers
+// take precedence when the request comes from a proxy trusted with
+// SetTrustedProxies, so links are correct behind a proxy.
+func (c *Context) BaseURL() string {
+	scheme := "http"
+	if c.request.TLS != nil {
+		scheme = "https"
+	}
+	host := c.request.Host
+	if c.trustForwarded() {
+		if proto := c.Header("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+		if fhost := c.Header("X-Forwarded-Host"); fhost != "" {
+			host = fhost
+		}
+	}
+	return scheme + "://" + host
+}
+
+// RealURL returns the absolute URL of the given path on the BaseURL of the
+// current request.
+// 	ctx.RealURL("/reset?token=abc") => "https://example.com/reset?token=abc"
+func (c *Context) RealURL(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return c.BaseURL() + p
+}
+
+// trustForwarded reports whether the forwarded headers of the request may be
+// honored, which is only the case for requests coming from a trusted proxy.
+func (c *Context) trustForwarded() bool {
+	if c.weavebox == nil || c.weavebox.trustedProxies == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(c.request.RemoteAddr)
+	if err != nil {
+		host = c.request.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range *c.weavebox.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // Query returns the url query parameter by its name.
 // 	app.Get("/api?limit=25", ..) => ctx.Query("limit")
 func (c *Context) Query(name string) string {
-	return c.request.URL.Query().Get(name)
+	return c.QueryValues().Get(name)
+}
+
+// QueryInt returns the url query parameter as an int. When the parameter is
+// missing or not an integer an HTTPError with status 400 naming the parameter
+// is returned.
+func (c *Context) QueryInt(name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, c.HTTPError(http.StatusBadRequest, fmt.Sprintf("missing query parameter %s", name))
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, c.HTTPError(http.StatusBadRequest, fmt.Sprintf("query parameter %s must be an integer", name))
+	}
+	return n, nil
+}
+
+// QueryValues returns all url query parameters. The query is parsed only once
+// per request.
+func (c *Context) QueryValues() url.Values {
+	if c.query == nil {
+		c.query = c.request.URL.Query()
+	}
+	return c.query
+}
+
+// Cursor returns the base64 decoded pagination cursor from the url query
+// parameter with the given name. An empty string is returned if the parameter
+// is not present. An HTTPError with status 400 is returned for an invalid
+// cursor.
+func (c *Context) Cursor(name string) (string, error) {
+	cursor := c.Query(name)
+	if cursor == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", c.HTTPError(http.StatusBadRequest, "invalid cursor")
+	}
+	return string(b), nil
+}
+
+// SetNextCursor encodes the cursor in the url query parameter with the given
+// name, and sets a Link header pointing to the next page.
+// 	Link: </users?cursor=MTIz>; rel="next"
+func (c *Context) SetNextCursor(name, cursor string) {
+	u := *c.request.URL
+	query := u.Query()
+	query.Set(name, base64.RawURLEncoding.EncodeToString([]byte(cursor)))
+	u.RawQuery = query.Encode()
+	c.response.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"next\"", u.RequestURI()))
 }
 
 // Form returns the form parameter by its name
 func (c *Context) Form(name string) string {
+	c.parseMultipartForm()
 	return c.request.FormValue(name)
 }
 
+// FormFile returns the uploaded file of the multipart form by its name. If the
+// field is missing http.ErrMissingFile is returned. If the request is not a
+// multipart form or could not be parsed an HTTPError with status 400 is
+// returned.
+func (c *Context) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	if err := c.parseMultipartForm(); err != nil {
+		return nil, nil, c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	f, fh, err := c.request.FormFile(name)
+	if err == http.ErrNotMultipart {
+		return nil, nil, c.HTTPError(http.StatusBadRequest, err.Error())
+	}
+	return f, fh, err
+}
+
+// SaveUploadedFile writes the content of the uploaded file to dst.
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// parseMultipartForm parses the request body as a multipart form, keeping at
+// most MaxMultipartMemory bytes of file parts in memory. Requests that are not
+// multipart are parsed as a regular form.
+func (c *Context) parseMultipartForm() error {
+	if c.request.MultipartForm != nil {
+		return nil
+	}
+	maxMemory := int64(defaultMaxMultipartMemory)
+	if c.weavebox != nil && c.weavebox.maxMultipartMemory > 0 {
+		maxMemory = c.weavebox.maxMultipartMemory
+	}
+	err := c.request.ParseMultipartForm(maxMemory)
+	if err == http.ErrNotMultipart {
+		return nil
+	}
+	return err
+}
+
 // Header returns the request header by name
 func (c *Context) Header(name string) string {
 	return c.request.Header.Get(name)
 }
 
+// ClientIP returns the IP address of the client. The X-Real-IP and
+// X-Forwarded-For headers are only honored for requests coming from a proxy
+// trusted with SetTrustedProxies, as any client can set them.
+func (c *Context) ClientIP() string {
+	if c.trustForwarded() {
+		if ip := c.Header("X-Real-IP"); ip != "" {
+			return ip
+		}
+		if fwd := c.Header("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	return c.remoteIP()
+}
+
+// remoteIP returns the IP address of the connection of the request.
+func (c *Context) remoteIP() string {
+	host, _, err := net.SplitHostPort(c.request.RemoteAddr)
+	if err != nil {
+		return c.request.RemoteAddr
+	}
+	return host
+}
+
 // SetHeader set a header to the response. If the header allready exists the
 // value will be overidden.
 func (c *Context) SetHeader(key, value string) {
@@ -377,17 +1876,193 @@ func (c *Context) Redirect(url string, code int) error {
 	return nil
 }
 
-// Set can be used to store values in the context. Weavebox uses Google context
-// for passing that value arround requests in a thread safe way.
-func (c *Context) Set(key string, value interface{}) {
+// File serves the file at the given path. Conditional requests are answered
+// with a 304 Not Modified based on the files ETag and Last-Modified headers.
+func (c *Context) File(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", file)
+	}
+	setFileETag(c.response, f)
+	http.ServeContent(c.response, c.request, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// Attachment serves the file at the given path as a download with the given
+// filename.
+func (c *Context) Attachment(file, name string) error {
+	c.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	return c.File(file)
+}
+
+// Stream serves the content of the given io.ReadSeeker. Range requests are
+// answered with a 206 Partial Content, which makes it suitable for seekable
+// media. The name is used to detect the Content-Type if it is not set.
+// 	f, _ := os.Open("video.mp4")
+// 	return c.Stream("video.mp4", time.Time{}, f)
+func (c *Context) Stream(name string, modtime time.Time, content io.ReadSeeker) error {
+	http.ServeContent(c.response, c.request, name, modtime, content)
+	return nil
+}
+
+// Writer writes the status code and the Content-Type header and returns a
+// writer to stream the body into. Each Write is flushed to the client, so
+// generated output is sent as soon as it is written.
+// 	w := csv.NewWriter(c.Writer(http.StatusOK, "text/csv"))
+// 	for _, row := range rows {
+// 		w.Write(row)
+// 		w.Flush()
+// 	}
+// 	return w.Error()
+func (c *Context) Writer(code int, contentType string) io.Writer {
+	c.response.Header().Set("Content-Type", contentType)
+	c.response.WriteHeader(code)
+	return flushWriter{c.response}
+}
+
+// flushWriter flushes the ResponseWriter after each Write.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// IsRange reports whether the request asks for a part of the content by
+// sending a bytes Range header. File, Attachment and Stream answer malformed
+// or unsatisfiable ranges with a 416 Requested Range Not Satisfiable.
+func (c *Context) IsRange() bool {
+	if c.request.Method != "GET" && c.request.Method != "HEAD" {
+		return false
+	}
+	return strings.HasPrefix(c.Header("Range"), "bytes=")
+}
+
+// SetETag sets the ETag header of the response. If the request contains a
+// matching If-None-Match header a 304 Not Modified is written and SetETag
+// returns true, in that case the handler should not write a body.
+// 	if c.SetETag(version) {
+// 		return nil
+// 	}
+func (c *Context) SetETag(tag string) bool {
+	if !strings.HasPrefix(tag, "W/") && !strings.HasPrefix(tag, "\"") {
+		tag = "\"" + tag + "\""
+	}
+	c.SetHeader("Etag", tag)
+	if c.request.Method != "GET" && c.request.Method != "HEAD" {
+		return false
+	}
+	if !etagMatch(c.Header("If-None-Match"), tag) {
+		return false
+	}
+	c.response.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch reports whether the If-None-Match header matches the tag, using
+// weak comparison.
+func etagMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// setFileETag sets a weak ETag based on the size and modification time of f.
+func setFileETag(rw http.ResponseWriter, f http.File) {
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return
+	}
+	rw.Header().Set("Etag", fmt.Sprintf("W/\"%x-%x\"", info.ModTime().Unix(), info.Size()))
+}
+
+// Set can be used to store values in the context. The values are kept in a
+// single store per request, shared by all middleware, the handler and the
+// errorHandler. They are also added to the Google context, so they can be
+// retrieved with ctx.Context.Value(key) as well.
+//
+// Like context.WithValue, the key should be of an unexported type defined in
+// the package that sets the value, so it can not collide with keys of other
+// packages.
+// 	type contextKey int
+//
+// 	const datastoreKey contextKey = 0
+//
+// 	ctx.Set(datastoreKey, store)
+// 	store, _ := ctx.Get(datastoreKey).(*Datastore)
+func (c *Context) Set(key interface{}, value interface{}) {
+	if c.store == nil {
+		c.store = map[interface{}]interface{}{}
+	}
+	c.store[key] = value
 	c.Context = context.WithValue(c.Context, key, value)
 }
 
-// Get retrieves the stored value from the context.
-func (c *Context) Get(key string) interface{} {
+// Get retrieves the stored value from the context. Values that are not set
+// with Set are looked up in the Google context.
+func (c *Context) Get(key interface{}) interface{} {
+	if v, ok := c.store[key]; ok {
+		return v
+	}
+	if c.Context == nil {
+		return nil
+	}
 	return c.Context.Value(key)
 }
 
+// GetOk retrieves the stored value like Get, and reports whether the value
+// was set, even when it was set to nil. For values that are not set with Set,
+// a nil value in the Google context is reported as not set.
+func (c *Context) GetOk(key interface{}) (interface{}, bool) {
+	if v, ok := c.store[key]; ok {
+		return v, true
+	}
+	v := c.Get(key)
+	return v, v != nil
+}
+
+// GetString retrieves the stored value as a string. The second return value
+// reports whether the value was set and is a string.
+func (c *Context) GetString(key interface{}) (string, bool) {
+	v, ok := c.Get(key).(string)
+	return v, ok
+}
+
+// GetInt retrieves the stored value as an int. The second return value
+// reports whether the value was set and is an int.
+func (c *Context) GetInt(key interface{}) (int, bool) {
+	v, ok := c.Get(key).(int)
+	return v, ok
+}
+
+// GetBool retrieves the stored value as a bool. The second return value
+// reports whether the value was set and is a bool.
+func (c *Context) GetBool(key interface{}) (bool, bool) {
+	v, ok := c.Get(key).(bool)
+	return v, ok
+}
+
 type HTTPError struct {
 	Code        int    `json:"code"`
 	Description string `json:"description"`
@@ -417,12 +2092,99 @@ func (c *Context) HTTPError(code int, desc string) HTTPError {
 	}
 }
 
+// Error writes an HTTPError with the given status code and message as JSON,
+// like {"code":404,"description":"user not found"}, and returns it. When a
+// custom ErrorHandler is set nothing is written, the returned error is left to
+// the ErrorHandler instead.
+// 	if user == nil {
+// 		return ctx.Error(http.StatusNotFound, "user not found")
+// 	}
+func (c *Context) Error(code int, message string) error {
+	err := c.HTTPError(code, message)
+	if c.weavebox != nil && !c.weavebox.hasDefaultErrorHandler() {
+		return err
+	}
+	if jsonErr := c.JSON(code, err); jsonErr != nil {
+		return jsonErr
+	}
+	c.writtenErr = err
+	return err
+}
+
+// ValidationError describes why the value of a single field is invalid.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors can be returned by handlers and validators to report
+// invalid input. The default errorHandler will respond with a 422 and a JSON
+// array holding all the field errors. It implements FieldErrors, so Bind
+// returns it from a validator as is.
+type ValidationErrors []ValidationError
+
+// FieldErrors implements the FieldErrors interface. Messages of the same field
+// are joined.
+func (e ValidationErrors) FieldErrors() map[string]string {
+	fields := make(map[string]string, len(e))
+	for _, err := range e {
+		if msg, ok := fields[err.Field]; ok {
+			fields[err.Field] = msg + ", " + err.Message
+			continue
+		}
+		fields[err.Field] = err.Message
+	}
+	return fields
+}
+
+// Error implements the error interface
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Field + ": " + err.Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Stack returns the stack trace of the recovered panic, or the current stack
+// trace if the handler did not panic.
+func (c *Context) Stack() []byte {
+	if c.stack != nil {
+		return c.stack
+	}
+	trace := make([]byte, 4096)
+	n := runtime.Stack(trace, false)
+	return trace[:n]
+}
+
 // Log provides a structured logging tool based on go-kit's logger. Weavebox
 // thinks structured logging is key in modern api's and webapps, its readable and
 // eazy for machines to parse it.
 // EG: c.Log("handler", "CreateUser", "input", User, "took", time.Since(start))
 func (c *Context) Log(keyvals ...interface{}) {
-	c.weavebox.logger.Log(keyvals...)
+	c.Logger().Log(keyvals...)
+}
+
+// Logger returns the logger of the application tagged with the route and, if
+// the RequestID middleware is used, the id of the current request.
+func (c *Context) Logger() kitlog.Logger {
+	keyvals := []interface{}{"route", c.route}
+	if id := c.RequestID(); id != "" {
+		keyvals = append(keyvals, "request_id", id)
+	}
+	return taggedLogger{logger: c.weavebox.logger, keyvals: keyvals}
+}
+
+// taggedLogger prepends its keyvals to every log line.
+type taggedLogger struct {
+	logger  kitlog.Logger
+	keyvals []interface{}
+}
+
+func (l taggedLogger) Log(keyvals ...interface{}) error {
+	kvs := make([]interface{}, 0, len(l.keyvals)+len(keyvals))
+	kvs = append(kvs, l.keyvals...)
+	return l.logger.Log(append(kvs, keyvals...)...)
 }
 
 type responseLogger struct {
@@ -444,11 +2206,40 @@ func (l *responseLogger) Header() http.Header {
 	return l.w.Header()
 }
 
+// WriteHeader ignores all but the first call, so writing an error after the
+// response is committed does not result in a superfluous WriteHeader call.
 func (l *responseLogger) WriteHeader(code int) {
+	if l.status != 0 {
+		return
+	}
 	l.w.WriteHeader(code)
 	l.status = code
 }
 
+func (l *responseLogger) Flush() {
+	if f, ok := l.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (l *responseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := l.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("weavebox: response does not implement http.Hijacker")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && l.status == 0 {
+		l.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, so http.ResponseController can
+// reach the connection deadlines.
+func (l *responseLogger) Unwrap() http.ResponseWriter {
+	return l.w
+}
+
 func (l *responseLogger) Status() int {
 	return l.status
 }
@@ -457,8 +2248,58 @@ func (l *responseLogger) Size() int {
 	return l.size
 }
 
+// noSniffWriter makes sure a Content-Type is set before the header is written,
+// so the http server will not sniff it.
+type noSniffWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *noSniffWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.ResponseWriter.Header()
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", "application/octet-stream")
+		}
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *noSniffWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *noSniffWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *noSniffWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *noSniffWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("weavebox: response does not implement http.Hijacker")
+	}
+	return hj.Hijack()
+}
+
 // Renderer renders any kind of template. Weavebox allows the use of different
 // template engines, if they implement the Render method.
 type Renderer interface {
 	Render(w io.Writer, name string, data interface{}) error
 }
+
+// LayoutRenderer is a Renderer that can render a template within a layout.
+type LayoutRenderer interface {
+	Renderer
+	RenderLayout(w io.Writer, layout, name string, data interface{}) error
+}
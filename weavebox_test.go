@@ -1,17 +1,28 @@
 package weavebox
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
-	"golang.org/x/net/context"
+	kitlog "github.com/go-kit/kit/log"
 )
 
 var noopHandler = func(ctx *Context) error { return nil }
@@ -47,6 +58,13 @@ func TestMethodPut(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestMethodPatch(t *testing.T) {
+	w := New()
+	w.Patch("/", noopHandler)
+	code, _ := doRequest(t, "PATCH", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
 func TestMethodDelete(t *testing.T) {
 	w := New()
 	w.Delete("/", noopHandler)
@@ -68,6 +86,58 @@ func TestMethodOptions(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestMatch(t *testing.T) {
+	w := New()
+	w.Box("/users").Match([]string{"PUT", "PATCH"}, "/:id", noopHandler)
+	for _, method := range []string{"PUT", "PATCH"} {
+		code, _ := doRequest(t, method, "/users/1", nil, w)
+		isHTTPStatusOK(t, code)
+	}
+	code, _ := doRequest(t, "POST", "/users/1", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+}
+
+func TestAny(t *testing.T) {
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.SetHeader("X-Box", "proxy")
+			return next(c)
+		}
+	})
+	w.Box("/proxy").Any("/*path", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Request().Method+" "+c.Param("path"))
+	})
+	for _, method := range anyMethods {
+		r, _ := http.NewRequest(method, "/proxy/users/1", nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		isHTTPStatusOK(t, rw.Code)
+		if want, have := "proxy", rw.Header().Get("X-Box"); want != have {
+			t.Errorf("%s: expecting %s have %s", method, want, have)
+		}
+		if want, have := method+" /users/1", rw.Body.String(); method != "HEAD" && want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	w := New()
+	w.Index(func(c *Context) error {
+		return c.Text(http.StatusOK, "welcome")
+	})
+	code, body := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "welcome", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	code, _ = doRequest(t, "HEAD", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
 func TestBox(t *testing.T) {
 	w := New()
 	sr := w.Box("/foo")
@@ -76,6 +146,244 @@ func TestBox(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
+func TestStaticAndParamRoutes(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", func(c *Context) error {
+		return c.Text(http.StatusOK, "param "+c.Param("id"))
+	})
+	admin := w.Box("/admin")
+	admin.Get("/users", func(c *Context) error {
+		return c.Text(http.StatusOK, fmt.Sprintf("static %d", len(c.Params())))
+	})
+
+	tests := []struct {
+		method string
+		route  string
+		code   int
+		body   string
+	}{
+		{"GET", "/admin/users", http.StatusOK, "static 0"},
+		{"GET", "/users/1", http.StatusOK, "param 1"},
+		{"POST", "/admin/users", http.StatusMethodNotAllowed, ""},
+		{"GET", "/admin/foo", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, test.method, test.route, nil, w)
+		if want, have := test.code, code; want != have {
+			t.Errorf("%s %s: expecting %d have %d", test.method, test.route, want, have)
+		}
+		if test.body != "" && test.body != body {
+			t.Errorf("%s %s: expecting %s have %s", test.method, test.route, test.body, body)
+		}
+	}
+}
+
+func TestStrictResponse(t *testing.T) {
+	w := New()
+	w.SetLogger(kitlog.NewNopLogger())
+	w.Get("/forgot", noopHandler)
+	w.Get("/ok", func(c *Context) error {
+		return c.Text(http.StatusOK, "ok")
+	})
+
+	code, _ := doRequest(t, "GET", "/forgot", nil, w)
+	isHTTPStatusOK(t, code)
+
+	w.SetStrictResponse(true)
+	code, body := doRequest(t, "GET", "/forgot", nil, w)
+	if want, have := http.StatusInternalServerError, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := ErrNoResponse.Error()+"\n", body; want != have {
+		t.Errorf("expecting %q have %q", want, have)
+	}
+	code, _ = doRequest(t, "GET", "/ok", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestServeListener(t *testing.T) {
+	w := New()
+	w.Output = ioutil.Discard
+	w.Get("/", func(c *Context) error {
+		return c.Text(http.StatusOK, "listening")
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go w.ServeListener(l)
+
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	isHTTPStatusOK(t, resp.StatusCode)
+	if want, have := "listening", string(body); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestRegisterAfterServe(t *testing.T) {
+	noopMiddleware := func(next Handler) Handler { return next }
+	w := New()
+	w.Get("/", noopHandler)
+	w.Group("auth", noopMiddleware)
+	route := w.Get("/users/:id", noopHandler)
+	w.freeze()
+
+	done := make(chan bool)
+	go func() {
+		defer func() { done <- recover() != nil }()
+		w.Get("/late", noopHandler)
+	}()
+	for i := 0; i < 10; i++ {
+		doRequest(t, "GET", "/", nil, w)
+	}
+	if !<-done {
+		t.Error("expecting a panic when registering a route after serving")
+	}
+	if code, _ := doRequest(t, "GET", "/late", nil, w); code != http.StatusNotFound {
+		t.Errorf("expecting code 404 got %d", code)
+	}
+
+	for name, register := range map[string]func(){
+		"Group":               func() { w.Group("admin", noopMiddleware) },
+		"UseGroup":            func() { w.Box("/admin").UseGroup("auth") },
+		"OnFinish":            func() { w.OnFinish(func(*Context) {}) },
+		"SetValidator":        func() { w.SetValidator(func(interface{}) error { return nil }) },
+		"RegisterBinder":      func() { w.RegisterBinder("text/plain", bindJSON) },
+		"SetMethodNotAllowed": func() { w.SetMethodNotAllowed(http.NotFoundHandler()) },
+		"Route.Use":           func() { route.Use(noopMiddleware) },
+		"Route.Where":         func() { route.Where("id", Numeric) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expecting a panic after serving", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestServeAddrInvalid(t *testing.T) {
+	w := New()
+	w.Output = ioutil.Discard
+	if err := w.ServeAddr("127.0.0.1:-1"); err == nil {
+		t.Error("expecting an error for an invalid address")
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	w := New()
+	w.Get("/api/users/:name", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("name")+" "+c.Request().URL.Path)
+	})
+	w.Get("/api/files/*filepath", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("filepath"))
+	})
+	w.Get("/api/status", func(c *Context) error {
+		return c.Text(http.StatusOK, "ok")
+	})
+
+	if code, _ := doRequest(t, "GET", "/API/Status", nil, w); code == http.StatusOK {
+		t.Error("expecting case sensitive routing by default")
+	}
+
+	w.CaseInsensitive = true
+	tests := []struct {
+		route string
+		body  string
+	}{
+		{"/API/Status", "ok"},
+		{"/Api/Users/Anthony", "Anthony /Api/Users/Anthony"},
+		{"/api/FILES/Docs/README.md", "/Docs/README.md"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		isHTTPStatusOK(t, code)
+		if want, have := test.body, body; want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
+		}
+	}
+}
+
+func TestCaseInsensitiveStaticAndHandle(t *testing.T) {
+	w := New()
+	w.CaseInsensitive = true
+	w.Static("/public", "./")
+	w.Handle("GET", "/raw", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.URL.Path))
+	}))
+	w.Get("/API/Users/:userId", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("userId"))
+	})
+
+	tests := []struct {
+		route string
+		body  string
+	}{
+		{"/Public/README.md", "weavebox"},
+		{"/RAW", "/RAW"},
+		{"/api/users/Anthony", "Anthony"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		isHTTPStatusOK(t, code)
+		if !strings.Contains(body, test.body) {
+			t.Errorf("%s: expecting %s have %s", test.route, test.body, body)
+		}
+	}
+}
+
+func TestSetCleanPath(t *testing.T) {
+	w := New()
+	w.Get("/files/:name", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("name"))
+	})
+
+	code, _ := doRequest(t, "GET", "/files//abc", nil, w)
+	if want, have := http.StatusMovedPermanently, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+
+	w.SetCleanPath(false)
+	code, _ = doRequest(t, "GET", "/files//abc", nil, w)
+	if want, have := http.StatusNotFound, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	code, _ = doRequest(t, "GET", "/files/abc/", nil, w)
+	if want, have := http.StatusNotFound, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	code, body := doRequest(t, "GET", "/files/YWJj==", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "YWJj==", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestMountStripPrefix(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("id"))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", w))
+
+	r, _ := http.NewRequest("GET", "/api/users/123", nil)
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "123", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
 func TestStatic(t *testing.T) {
 	w := New()
 	w.Static("/public", "./")
@@ -94,6 +402,242 @@ func TestStatic(t *testing.T) {
 	}
 }
 
+func TestStaticDisableListing(t *testing.T) {
+	w := New()
+	w.StaticWithOptions("/public", "./", StaticOptions{DisableListing: true})
+	w.StaticWithOptions("/listed", "./", StaticOptions{})
+
+	code, _ := doRequest(t, "GET", "/public/README.md", nil, w)
+	isHTTPStatusOK(t, code)
+	for _, route := range []string{"/public/", "/public/weavebook/"} {
+		code, _ = doRequest(t, "GET", route, nil, w)
+		if want, have := http.StatusNotFound, code; want != have {
+			t.Errorf("%s: expecting %d have %d", route, want, have)
+		}
+	}
+
+	code, body := doRequest(t, "GET", "/listed/", nil, w)
+	isHTTPStatusOK(t, code)
+	if !strings.Contains(body, "README.md") {
+		t.Errorf("expecting a listing containing README.md have %s", body)
+	}
+}
+
+func TestStaticFS(t *testing.T) {
+	w := New()
+	fs := fstest.MapFS{
+		"css/app.css": &fstest.MapFile{Data: []byte("body {}")},
+	}
+	w.StaticFS("/assets", http.FS(fs))
+
+	code, body := doRequest(t, "GET", "/assets/css/app.css", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "body {}", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	code, _ = doRequest(t, "GET", "/assets/nofile", nil, w)
+	if code != http.StatusNotFound {
+		t.Errorf("expecting status 404 got %d", code)
+	}
+}
+
+func TestStaticFallback(t *testing.T) {
+	w := New()
+	w.StaticFallback("/app", "./", "README.md")
+
+	code, body := doRequest(t, "GET", "/app/LICENSE", nil, w)
+	isHTTPStatusOK(t, code)
+	if strings.Contains(body, "weavebox") {
+		t.Error("expecting the requested file, not the fallback")
+	}
+
+	code, body = doRequest(t, "GET", "/app/users/profile", nil, w)
+	isHTTPStatusOK(t, code)
+	if !strings.Contains(body, "weavebox") {
+		t.Error("expecting body containing string (weavebox)")
+	}
+
+	code, _ = doRequest(t, "GET", "/app/missing.js", nil, w)
+	if code != http.StatusNotFound {
+		t.Errorf("expecting status 404 got %d", code)
+	}
+}
+
+func TestStaticFallbackRoot(t *testing.T) {
+	w := New()
+	w.Get("/api/users/:id", func(c *Context) error {
+		return c.Text(http.StatusOK, "user "+c.Param("id"))
+	})
+	w.StaticFallback("/", "./", "README.md")
+
+	code, body := doRequest(t, "GET", "/api/users/1", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "user 1", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	code, body = doRequest(t, "GET", "/settings/profile", nil, w)
+	isHTTPStatusOK(t, code)
+	if !strings.Contains(body, "weavebox") {
+		t.Error("expecting the fallback file")
+	}
+
+	code, body = doRequest(t, "GET", "/LICENSE", nil, w)
+	isHTTPStatusOK(t, code)
+	if strings.Contains(body, "weavebox") {
+		t.Error("expecting the requested file, not the fallback")
+	}
+
+	for _, test := range []struct{ method, route string }{
+		{"GET", "/missing.js"},
+		{"POST", "/settings/profile"},
+	} {
+		code, _ = doRequest(t, test.method, test.route, nil, w)
+		if want, have := http.StatusNotFound, code; want != have {
+			t.Errorf("%s %s: expecting %d have %d", test.method, test.route, want, have)
+		}
+	}
+}
+
+func TestStaticNotModified(t *testing.T) {
+	w := New()
+	w.Static("/public", "./")
+
+	r, _ := http.NewRequest("GET", "/public/README.md", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	etag := rw.Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("expecting an ETag header")
+	}
+
+	r, _ = http.NewRequest("GET", "/public/README.md", nil)
+	r.Header.Set("If-None-Match", etag)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expecting status 304 got %d", rw.Code)
+	}
+}
+
+func TestContextFile(t *testing.T) {
+	w := New()
+	w.Get("/readme", func(c *Context) error {
+		return c.File("README.md")
+	})
+	w.Get("/download", func(c *Context) error {
+		return c.Attachment("README.md", "readme.md")
+	})
+
+	r, _ := http.NewRequest("GET", "/readme", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if !strings.Contains(rw.Body.String(), "weavebox") {
+		t.Error("expecting body containing string (weavebox)")
+	}
+
+	r, _ = http.NewRequest("GET", "/readme", nil)
+	r.Header.Set("If-None-Match", rw.Header().Get("Etag"))
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expecting status 304 got %d", rw.Code)
+	}
+
+	r, _ = http.NewRequest("GET", "/download", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := `attachment; filename="readme.md"`, rw.Header().Get("Content-Disposition"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextRange(t *testing.T) {
+	w := New()
+	w.Get("/file", func(c *Context) error {
+		return c.File("README.md")
+	})
+	w.Get("/stream", func(c *Context) error {
+		return c.Stream("data.txt", time.Time{}, strings.NewReader("0123456789"))
+	})
+
+	r, _ := http.NewRequest("GET", "/stream", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusPartialContent {
+		t.Errorf("expecting status 206 got %d", rw.Code)
+	}
+	if want, have := "2345", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ = http.NewRequest("GET", "/file", nil)
+	r.Header.Set("Range", "bytes=0-1")
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusPartialContent {
+		t.Errorf("expecting status 206 got %d", rw.Code)
+	}
+	if want, have := "# ", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextIsRange(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		if !c.IsRange() {
+			t.Error("expecting a range request")
+		}
+		return c.Stream("data.txt", time.Time{}, strings.NewReader("0123456789"))
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Range", "bytes=20-30")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expecting status 416 got %d", rw.Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	ctx := &Context{request: req}
+	if ctx.IsRange() {
+		t.Error("expecting no range request")
+	}
+}
+
+func TestContextSetETag(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		if c.SetETag("v1") {
+			return nil
+		}
+		return c.Text(http.StatusOK, "fresh")
+	})
+
+	code, body := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "fresh", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", `"v1"`)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if rw.Code != http.StatusNotModified {
+		t.Errorf("expecting status 304 got %d", rw.Code)
+	}
+	if rw.Body.Len() != 0 {
+		t.Errorf("expecting empty body got %s", rw.Body.String())
+	}
+}
+
 func TestContext(t *testing.T) {
 	w := New()
 	w.Get("/", checkContext(t, "m1", "m1"))
@@ -151,14 +695,58 @@ func TestBindContext(t *testing.T) {
 	isHTTPStatusOK(t, code)
 }
 
-func TestBindContextSubrouter(t *testing.T) {
+func TestContextFromRequest(t *testing.T) {
 	w := New()
-	sub := w.Box("/foo")
-	sub.Get("/", checkContext(t, "foo", "bar"))
-	sub.BindContext(context.WithValue(context.Background(), "foo", "bar"))
-
-	code, _ := doRequest(t, "GET", "/foo", nil, w)
-	isHTTPStatusOK(t, code)
+	w.BindContext(context.WithValue(context.Background(), "a", "b"))
+	w.Get("/", func(c *Context) error {
+		if want, have := "b", c.Get("a"); want != have {
+			t.Errorf("expecting %s have %v", want, have)
+		}
+		select {
+		case <-c.Context.Done():
+			return nil
+		case <-time.After(time.Second):
+			t.Error("expecting the context to be cancelled with the request")
+			return nil
+		}
+	})
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(reqCtx)
+	w.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestBindContextSubrouter(t *testing.T) {
+	w := New()
+	sub := w.Box("/foo")
+	sub.Get("/", checkContext(t, "foo", "bar"))
+	sub.BindContext(context.WithValue(context.Background(), "foo", "bar"))
+
+	code, _ := doRequest(t, "GET", "/foo", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestBindContextNestedBoxes(t *testing.T) {
+	w := New()
+	w.BindContext(context.WithValue(context.WithValue(context.Background(), "a", "parent"), "b", "parent"))
+
+	child := w.Box("/child")
+	child.BindContext(context.WithValue(context.Background(), "a", "child"))
+	child.Get("/a", checkContext(t, "a", "child"))
+	child.Get("/b", checkContext(t, "b", "parent"))
+
+	sibling := w.Box("/sibling")
+	sibling.Get("/a", checkContext(t, "a", "parent"))
+
+	nested := child.Box("/nested")
+	nested.Get("/a", checkContext(t, "a", "child"))
+
+	for _, route := range []string{"/child/a", "/child/b", "/sibling/a", "/child/nested/a"} {
+		code, _ := doRequest(t, "GET", route, nil, w)
+		isHTTPStatusOK(t, code)
+	}
 }
 
 func checkContext(t *testing.T, key, expect string) Handler {
@@ -194,251 +782,1649 @@ func TestMiddleware(t *testing.T) {
 	})
 	w.Use(func(next Handler) Handler {
 		return func(c *Context) error {
-			buf.WriteString("d")
+			buf.WriteString("d")
+			return next(c)
+		}
+	})
+
+	w.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if buf.String() != "abcd" {
+		t.Error("expecting abcd got %s", buf.String())
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mw := func(s string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				buf.WriteString(s)
+				return next(c)
+			}
+		}
+	}
+	w := New()
+	w.Use(mw("a"))
+	w.Get("/admin", noopHandler, mw("b"), mw("c"))
+	w.Get("/", noopHandler)
+
+	code, _ := doRequest(t, "GET", "/admin", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "abc", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+
+	buf.Reset()
+	code, _ = doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "a", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+}
+
+func TestRouteHandle(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Get("/users/:id", noopHandler).Name("user").Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("a")
+			return next(c)
+		}
+	})
+
+	code, _ := doRequest(t, "GET", "/users/1", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "a", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+	u, err := w.URL("user", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "/users/1", u; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextStatusCode(t *testing.T) {
+	var status, size int
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			err := next(c)
+			status, size = c.StatusCode(), c.BytesWritten()
+			return err
+		}
+	})
+	w.Get("/", func(c *Context) error {
+		return c.Text(http.StatusCreated, "hello")
+	})
+
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusCreated {
+		t.Errorf("expecting code 201 got %d", code)
+	}
+	if want, have := http.StatusCreated, status; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := 5, size; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+func TestMiddlewareUseFor(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.UseFor([]string{"POST", "PUT"}, func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString(c.Request().Method)
+			return next(c)
+		}
+	})
+	w.Match([]string{"GET", "POST", "PUT"}, "/", noopHandler)
+
+	for _, method := range []string{"GET", "POST", "PUT"} {
+		code, _ := doRequest(t, method, "/", nil, w)
+		isHTTPStatusOK(t, code)
+	}
+	if want, have := "POSTPUT", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+}
+
+func TestContextWritten(t *testing.T) {
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			if c.Written() {
+				t.Error("expecting response not to be written")
+			}
+			if err := next(c); err != nil {
+				return err
+			}
+			if !c.Written() {
+				return c.Text(http.StatusNoContent, "")
+			}
+			return nil
+		}
+	})
+	w.Get("/write", func(c *Context) error {
+		_, err := c.Response().Write([]byte("foo"))
+		return err
+	})
+	w.Get("/empty", noopHandler)
+
+	code, _ := doRequest(t, "GET", "/write", nil, w)
+	isHTTPStatusOK(t, code)
+	code, _ = doRequest(t, "GET", "/empty", nil, w)
+	if code != http.StatusNoContent {
+		t.Errorf("expecting code 204 got %d", code)
+	}
+}
+
+func TestMiddlewareUsePre(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mw := func(s string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				buf.WriteString(s)
+				return next(c)
+			}
+		}
+	}
+	w := New()
+	w.Use(mw("c"), mw("d"))
+	w.UsePre(mw("a"), mw("b"))
+
+	w.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "abcd", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+}
+
+func TestBoxMiddlewareReset(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("a")
+			return next(c)
+		}
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("b")
+			return next(c)
+		}
+	})
+
+	sub := w.Box("/sub").ResetMiddleware()
+	sub.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/sub", nil, w)
+	isHTTPStatusOK(t, code)
+	if buf.String() != "" {
+		t.Error("expecting empty buffer got %s", buf.String())
+	}
+}
+
+func TestBoxWithout(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+
+	w.UseNamed("logging", func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("log")
+			return next(c)
+		}
+	})
+	w.UseNamed("auth", func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("auth")
+			return next(c)
+		}
+	})
+
+	sub := w.Box("/public").Without("auth")
+	sub.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/public", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "log", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+
+	buf.Reset()
+	w.Get("/", noopHandler)
+	code, _ = doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "logauth", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+}
+
+func TestMiddlewareGroup(t *testing.T) {
+	buf := &bytes.Buffer{}
+	write := func(s string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *Context) error {
+				buf.WriteString(s)
+				return next(c)
+			}
+		}
+	}
+	w := New()
+	w.Group("auth", write("session"), write("login"))
+
+	admin := w.Box("/admin")
+	admin.Use(write("log"))
+	admin.UseGroup("auth")
+	admin.Get("/", noopHandler)
+	public := admin.Box("/public").Without("auth")
+	public.Get("/", noopHandler)
+
+	code, _ := doRequest(t, "GET", "/admin", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "logsessionlogin", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+
+	buf.Reset()
+	code, _ = doRequest(t, "GET", "/admin/public", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "log", buf.String(); want != have {
+		t.Errorf("expecting %s got %s", want, have)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expecting a panic for an undefined group")
+		}
+	}()
+	w.UseGroup("nope")
+}
+
+func TestBoxMiddlewareInheritsParent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("a")
+			return next(c)
+		}
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("b")
+			return next(c)
+		}
+	})
+
+	sub := w.Box("/sub")
+	sub.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/sub", nil, w)
+	isHTTPStatusOK(t, code)
+	if buf.String() != "ab" {
+		t.Error("expecting ab got %s", buf.String())
+	}
+}
+
+func TestParentNotInheritBoxMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := New()
+	w.Get("/foo", noopHandler)
+	sub := w.Box("/sub")
+
+	sub.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			buf.WriteString("a")
+			return next(c)
+		}
+	})
+
+	doRequest(t, "GET", "/foo", nil, w)
+	if buf.String() == "a" {
+		t.Error("parent cannot inherit box middleware")
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	w := New()
+	errorMsg := "oops! something went wrong"
+	w.SetErrorHandler(func(ctx *Context, err error) {
+		ctx.Response().WriteHeader(http.StatusInternalServerError)
+		if err.Error() != errorMsg {
+			t.Error("expecting %s, got %s", errorMsg, err.Error())
+		}
+	})
+
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			return errors.New(errorMsg)
+		}
+	})
+
+	w.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusInternalServerError {
+		t.Error("expecting code 500 got %s", code)
+	}
+}
+
+func TestSetJSONEncoder(t *testing.T) {
+	w := New()
+	w.SetJSONEncoder(func(w io.Writer, v interface{}) error {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(v)
+	})
+	w.Get("/", func(c *Context) error {
+		return c.JSON(http.StatusOK, "<b>bold</b>")
+	})
+	code, body := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "\"<b>bold</b>\"\n", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextJSONEncodeError(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		return c.JSON(http.StatusOK, make(chan int))
+	})
+	code, body := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusInternalServerError {
+		t.Errorf("expecting code 500 got %d", code)
+	}
+	if !strings.Contains(body, "unsupported type") {
+		t.Errorf("expecting the encode error in the body got %s", body)
+	}
+}
+
+func TestContextStopJSON(t *testing.T) {
+	w := New()
+	w.SetErrorHandler(func(c *Context, err error) {
+		t.Errorf("error handler should not be invoked, got %s", err)
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			return c.StopJSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+	})
+	w.Get("/", func(c *Context) error {
+		t.Error("handler should not be invoked")
+		return nil
+	})
+
+	code, body := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expecting code 401 got %d", code)
+	}
+	if want, have := "{\"error\":\"unauthorized\"}\n", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextBlob(t *testing.T) {
+	w := New()
+	w.Get("/logo", func(c *Context) error {
+		return c.Blob(http.StatusCreated, "image/png", []byte("\x89PNG"))
+	})
+	w.Get("/raw", func(c *Context) error {
+		return c.Blob(http.StatusOK, "", []byte("<html>"))
+	})
+
+	r, _ := http.NewRequest("GET", "/logo", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := http.StatusCreated, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "image/png", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "4", rw.Header().Get("Content-Length"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "\x89PNG", rw.Body.String(); want != have {
+		t.Errorf("expecting %q have %q", want, have)
+	}
+
+	r, _ = http.NewRequest("GET", "/raw", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := "application/octet-stream", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestDebugStackTrace(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		w := New()
+		w.logger = kitlog.NewNopLogger()
+		w.Debug = debug
+		w.Get("/error", func(c *Context) error {
+			return errors.New("oops")
+		})
+		w.Get("/panic", func(c *Context) error {
+			panic("oops")
+		})
+
+		for _, route := range []string{"/error", "/panic"} {
+			code, body := doRequest(t, "GET", route, nil, w)
+			if code != http.StatusInternalServerError {
+				t.Errorf("expecting code 500 got %d", code)
+			}
+			if have := strings.Contains(body, "goroutine"); have != debug {
+				t.Errorf("%s: expecting stack trace in body to be %v", route, debug)
+			}
+		}
+	}
+}
+
+func TestWeaveboxHandler(t *testing.T) {
+	w := New()
+	handle := func(respStr string) Handler {
+		return func(ctx *Context) error {
+			return ctx.Text(http.StatusOK, respStr)
+		}
+	}
+	w.Get("/a", handle("a"))
+	w.Get("/b", handle("b"))
+	w.Get("/c", handle("c"))
+
+	for _, r := range []string{"a", "b", "c"} {
+		code, body := doRequest(t, "GET", "/"+r, nil, w)
+		isHTTPStatusOK(t, code)
+		if body != r {
+			t.Errorf("expecting %s got %s", r, body)
+		}
+	}
+}
+
+func TestContextHTML(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		return c.HTML(http.StatusOK, "<h1>weavebox</h1>")
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "text/html; charset=utf-8", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "<h1>weavebox</h1>", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	w := New()
+	code, body := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusNotFound {
+		t.Errorf("expecting code 404 got %d", code)
+	}
+	if !strings.Contains(body, "404 page not found") {
+		t.Errorf("expecting body: 404 page not found got %s", body)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	w := New()
+	w.JSONErrors = true
+	w.Get("/", func(c *Context) error {
+		return c.HTTPError(http.StatusBadRequest, "bad request")
+	})
+
+	for _, tt := range []struct {
+		method, route string
+		code          int
+		msg           string
+	}{
+		{"GET", "/nope", http.StatusNotFound, "404 page not found"},
+		{"POST", "/", http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{"GET", "/", http.StatusBadRequest, "bad request"},
+	} {
+		code, body := doRequest(t, tt.method, tt.route, nil, w)
+		if code != tt.code {
+			t.Errorf("expecting code %d got %d", tt.code, code)
+		}
+		var resp map[string]string
+		if err := json.NewDecoder(strings.NewReader(body)).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := tt.msg, resp["error"]; want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+	}
+}
+
+func TestNotFoundErrorHandler(t *testing.T) {
+	w := New()
+	w.Get("/", noopHandler)
+	w.SetErrorHandler(func(c *Context, err error) {
+		if httpErr, ok := err.(HTTPError); ok {
+			c.Text(httpErr.Code, "custom: "+httpErr.Description)
+		}
+	})
+
+	code, body := doRequest(t, "GET", "/nope", nil, w)
+	if code != http.StatusNotFound {
+		t.Errorf("expecting code 404 got %d", code)
+	}
+	if want, have := "custom: 404 page not found", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	code, body = doRequest(t, "POST", "/", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+	if want, have := "custom: Method Not Allowed", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestSetNotFound(t *testing.T) {
+	w := New()
+	notFoundMsg := "hey! not found"
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(notFoundMsg))
+	})
+	w.SetNotFoundHandler(h)
+
+	code, body := doRequest(t, "GET", "/", nil, w)
+	if code != http.StatusNotFound {
+		t.Errorf("expecting code 404 got %d", code)
+	}
+	if !strings.Contains(body, notFoundMsg) {
+		t.Errorf("expecting body: %s got %s", notFoundMsg, body)
+	}
+}
+
+func TestBoxNotFoundHandler(t *testing.T) {
+	w := New()
+	w.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>not found</h1>"))
+	}))
+	api := w.Box("/api")
+	api.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	}))
+
+	for route, want := range map[string]string{
+		"/api/users":  `{"error":"not found"}`,
+		"/api":        `{"error":"not found"}`,
+		"/apiv2":      "<h1>not found</h1>",
+		"/some/thing": "<h1>not found</h1>",
+	} {
+		code, body := doRequest(t, "GET", route, nil, w)
+		if code != http.StatusNotFound {
+			t.Errorf("expecting code 404 got %d", code)
+		}
+		if body != want {
+			t.Errorf("%s: expecting %s have %s", route, want, body)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.Set("mw", "mw")
+			return next(c)
+		}
+	})
+	w.Get("/users", noopHandler)
+	w.Fallback(func(c *Context) error {
+		return c.Text(http.StatusOK, c.Get("mw").(string)+" "+c.Request().URL.Path)
+	})
+	legacy := w.Box("/legacy")
+	legacy.Fallback(func(c *Context) error {
+		return c.Redirect("/users", http.StatusMovedPermanently)
+	})
+
+	code, body := doRequest(t, "GET", "/some/thing", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "mw /some/thing", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	code, _ = doRequest(t, "GET", "/legacy/users.php", nil, w)
+	if want, have := http.StatusMovedPermanently, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+func TestSetNotFoundMiddleware(t *testing.T) {
+	w := New()
+	w.Use(RequestID())
+	w.SetNotFound(func(c *Context) error {
+		return c.Text(http.StatusNotFound, "missing "+c.RequestID())
+	})
+	api := w.Box("/api")
+	api.SetNotFound(noopHandler)
+
+	r, _ := http.NewRequest("GET", "/nope", nil)
+	r.Header.Set("X-Request-ID", "abc")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := http.StatusNotFound, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "missing abc", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "abc", rw.Header().Get("X-Request-ID"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	code, body := doRequest(t, "GET", "/api/nope", nil, w)
+	if want, have := http.StatusNotFound, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "404 page not found\n", body; want != have {
+		t.Errorf("expecting %q have %q", want, have)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	w := New()
+	w.Get("/", noopHandler)
+	code, body := doRequest(t, "POST", "/", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+	if !strings.Contains(body, "Method Not Allowed") {
+		t.Errorf("expecting body: Method Not Allowed got %s", body)
+	}
+}
+
+func TestSetMethodNotAllowed(t *testing.T) {
+	w := New()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("foo"))
+	})
+	w.SetMethodNotAllowed(handler)
+	w.Get("/", noopHandler)
+
+	code, body := doRequest(t, "POST", "/", nil, w)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting code 405 got %d", code)
+	}
+	if !strings.Contains(body, "foo") {
+		t.Errorf("expecting body: foo got %s", body)
+	}
+
+	r, _ := http.NewRequest("POST", "/", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := "GET", rw.Header().Get("Allow"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestMethodNotAllowedAllowHeader(t *testing.T) {
+	w := New()
+	w.Get("/users/:id", noopHandler)
+	w.Put("/users/:id", noopHandler)
+	w.Delete("/users/:id", noopHandler)
+	w.Post("/users", noopHandler)
+
+	r, _ := http.NewRequest("PATCH", "/users/1", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := http.StatusMethodNotAllowed, rw.Code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "DELETE, GET, PUT", rw.Header().Get("Allow"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestBraceParams(t *testing.T) {
+	w := New()
+	w.Get("/users/{id}/posts/:post", func(c *Context) error {
+		return c.Text(http.StatusOK, c.Param("id")+"-"+c.Param("post"))
+	})
+	code, body := doRequest(t, "GET", "/users/1/posts/2", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "1-2", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextParams(t *testing.T) {
+	w := New()
+	w.Get("/:user/:repo", func(c *Context) error {
+		params := c.Params()
+		if len(params) != 2 {
+			t.Errorf("expecting 2 params got %d", len(params))
+		}
+		if want, have := "anthdm", params["user"]; want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+		if want, have := "weavebox", params["repo"]; want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+		return nil
+	})
+	code, _ := doRequest(t, "GET", "/anthdm/weavebox", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestContextRoutePattern(t *testing.T) {
+	w := New()
+	handler := func(c *Context) error {
+		return c.Text(http.StatusOK, c.RoutePattern())
+	}
+	w.Get("/users/:id", handler)
+	w.Box("/admin").Get("/users/:id", handler)
+
+	code, body := doRequest(t, "GET", "/users/123", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "/users/:id", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	code, body = doRequest(t, "GET", "/admin/users/456", nil, w)
+	isHTTPStatusOK(t, code)
+	if want, have := "/admin/users/:id", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestURL(t *testing.T) {
+	w := New()
+	w.Name("user", "/users/:id/posts/:post")
+	w.Box("/admin").Name("settings", "/settings/:section")
+
+	u, err := w.URL("user", "1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "/users/1/posts/2", u; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	u, err = w.URL("settings", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "/admin/settings/profile", u; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if _, err := w.URL("user", "1"); err == nil {
+		t.Error("expecting error for missing parameter")
+	}
+	if _, err := w.URL("nope"); err == nil {
+		t.Error("expecting error for unknown route")
+	}
+}
+
+func TestContextAbsoluteURL(t *testing.T) {
+	w := New()
+	w.Name("user", "/users/:id")
+	w.Get("/", func(c *Context) error {
+		u, err := c.AbsoluteURL("user", "123")
+		if err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, u)
+	})
+
+	if err := w.SetTrustedProxies("10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "example.com")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "https://example.com/users/123", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextRealURL(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		return c.Text(http.StatusOK, c.RealURL("reset?token=abc")+" "+c.ClientIP())
+	})
+
+	tests := []struct {
+		proxies    []string
+		remoteAddr string
+		body       string
+	}{
+		{nil, "1.2.3.4:1234", "http://localhost/reset?token=abc 1.2.3.4"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1:1234", "https://example.com/reset?token=abc 5.6.7.8"},
+		{[]string{"10.0.0.0/8", "127.0.0.1"}, "1.2.3.4:1234", "http://localhost/reset?token=abc 1.2.3.4"},
+	}
+	for _, test := range tests {
+		if err := w.SetTrustedProxies(test.proxies...); err != nil {
+			t.Fatal(err)
+		}
+		r, _ := http.NewRequest("GET", "http://localhost/", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "example.com")
+		r.Header.Set("X-Forwarded-For", "5.6.7.8")
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := test.body, rw.Body.String(); want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+	}
+	if err := w.SetTrustedProxies("nope"); err == nil {
+		t.Error("expecting an error for an invalid proxy")
+	}
+}
+
+func TestContextBaseURLSpoofedHost(t *testing.T) {
+	w := New()
+	w.Get("/", func(c *Context) error {
+		return c.Text(http.StatusOK, c.BaseURL())
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "example.com"
+	r.RemoteAddr = "1.2.3.4:1234"
+	r.Header.Set("X-Forwarded-Host", "evil.com")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := "http://example.com", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestSetTrustedProxiesAfterBox(t *testing.T) {
+	w := New()
+	b := w.Box("/api")
+	b.Get("/ip", func(c *Context) error {
+		return c.Text(http.StatusOK, c.ClientIP())
+	})
+	if err := w.SetTrustedProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("GET", "/api/ip", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := "5.6.7.8", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestContextURLQuery(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/?name=anthony", nil)
+	ctx := &Context{request: req}
+	if ctx.Query("name") != "anthony" {
+		t.Errorf("expected anthony got %s", ctx.Query("name"))
+	}
+}
+
+func TestContextQueryValues(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/?name=anthony&tag=a&tag=b", nil)
+	ctx := &Context{request: req}
+	for i := 0; i < 3; i++ {
+		if want, have := "anthony", ctx.Query("name"); want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+	}
+	values := ctx.QueryValues()
+	if want, have := "anthony", values.Get("name"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := 2, len(values["tag"]); want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+}
+
+func TestContextCursor(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/users?limit=10", nil)
+	rw := httptest.NewRecorder()
+	ctx := &Context{request: req, response: rw}
+	ctx.SetNextCursor("cursor", "user:123")
+
+	link := rw.Header().Get("Link")
+	if !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("expecting next link got %s", link)
+	}
+	next, err := http.NewRequest("GET", link[1:strings.Index(link, ">")], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "10", next.URL.Query().Get("limit"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	ctx = &Context{request: next}
+	cursor, err := ctx.Cursor("cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "user:123", cursor; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	req, _ = http.NewRequest("GET", "/users?cursor=!!", nil)
+	ctx = &Context{request: req}
+	if _, err := ctx.Cursor("cursor"); err == nil {
+		t.Error("expecting error for invalid cursor")
+	}
+}
+
+func TestContextForm(t *testing.T) {
+	values := url.Values{}
+	values.Set("email", "john@gmail.com")
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	ctx := &Context{request: req}
+	if ctx.Form("email") != "john@gmail.com" {
+		t.Errorf("expected john@gmail.com got %s", ctx.Form("email"))
+	}
+}
+
+func TestSetMaxMultipartMemory(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("name", "anthony")
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write(bytes.Repeat([]byte("a"), 1024))
+	mw.Close()
+
+	w := New()
+	w.SetMaxMultipartMemory(1)
+	w.Post("/", func(c *Context) error {
+		if want, have := "anthony", c.Form("name"); want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+		// the file part does not fit in memory and is stored on disk.
+		f, err := c.Request().MultipartForm.File["avatar"][0].Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, ok := f.(*os.File); !ok {
+			t.Error("expecting the file to be stored on disk")
+		}
+		return nil
+	})
+
+	r, _ := http.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	r.MultipartForm.RemoveAll()
+}
+
+func TestContextFormFile(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write([]byte("image"))
+	mw.Close()
+
+	dir := t.TempDir()
+	w := New()
+	w.Post("/", func(c *Context) error {
+		if _, _, err := c.FormFile("missing"); err != http.ErrMissingFile {
+			t.Errorf("expecting ErrMissingFile got %v", err)
+		}
+		f, fh, err := c.FormFile("avatar")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		if want, have := "avatar.png", fh.Filename; want != have {
+			t.Errorf("expecting %s have %s", want, have)
+		}
+		return c.SaveUploadedFile(fh, filepath.Join(dir, fh.Filename))
+	})
+
+	r, _ := http.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	b, err := os.ReadFile(filepath.Join(dir, "avatar.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "image", string(b); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ = http.NewRequest("POST", "/", strings.NewReader("garbage"))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=nope")
+	ctx := &Context{request: r}
+	_, _, err = ctx.FormFile("avatar")
+	if httpErr, ok := err.(HTTPError); !ok || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("expecting a 400 HTTPError got %v", err)
+	}
+}
+
+func TestContextFormFileNotMultipart(t *testing.T) {
+	w := New()
+	w.Post("/", func(c *Context) error {
+		_, _, err := c.FormFile("avatar")
+		return err
+	})
+
+	code, _ := doRequest(t, "POST", "/", strings.NewReader(`{"name":"anthony"}`), w)
+	if code != http.StatusBadRequest {
+		t.Errorf("expecting code 400 got %d", code)
+	}
+}
+
+func TestContextFormFileMissing(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("name", "anthony")
+	mw.Close()
+
+	r, _ := http.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	ctx := &Context{request: r}
+	if _, _, err := ctx.FormFile("avatar"); err != http.ErrMissingFile {
+		t.Errorf("expecting ErrMissingFile got %v", err)
+	}
+}
+
+func TestContextHeader(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Add("x-test", "test")
+	ctx := &Context{request: req}
+	if ctx.Header("x-test") != "test" {
+		t.Error("expected header to be (test) got %s", ctx.Header("x-test"))
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := httptest.NewRecorder()
+	ctx := &Context{request: req, response: resp}
+
+	ctx.SetHeader("X-Test", "foo")
+	ctx.SetHeader("X-Test", "bar")
+	if want, have := "bar", ctx.response.Header().Get("X-Test"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestCharset(t *testing.T) {
+	w := New()
+	w.Get("/text", func(c *Context) error {
+		return c.Text(http.StatusOK, "héllo")
+	})
+	w.Get("/json", func(c *Context) error {
+		return c.JSON(http.StatusOK, "héllo")
+	})
+	w.Get("/html", func(c *Context) error {
+		return c.HTML(http.StatusOK, "<p>héllo</p>")
+	})
+
+	tests := []struct {
+		charset     string
+		route       string
+		contentType string
+	}{
+		{"utf-8", "/text", "text/plain; charset=utf-8"},
+		{"utf-8", "/json", "application/json; charset=utf-8"},
+		{"utf-8", "/html", "text/html; charset=utf-8"},
+		{"", "/text", "text/plain"},
+		{"", "/json", "application/json"},
+		{"iso-8859-1", "/html", "text/html; charset=iso-8859-1"},
+	}
+	for _, test := range tests {
+		w.Charset = test.charset
+		r, _ := http.NewRequest("GET", test.route, nil)
+		rw := httptest.NewRecorder()
+		w.ServeHTTP(rw, r)
+		if want, have := test.contentType, rw.Header().Get("Content-Type"); want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
+		}
+	}
+}
+
+func TestContextSetGet(t *testing.T) {
+	w := New()
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			c.Set("foo", "bar")
+			return nil
+		}
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			if want, have := "bar", c.Get("foo").(string); want != have {
+				t.Error("expected %s but got %s", want, have)
+			}
+			return nil
+		}
+	})
+	w.Get("/", noopHandler)
+	code, _ := doRequest(t, "GET", "/", nil, w)
+	isHTTPStatusOK(t, code)
+}
+
+func TestContextTypedGet(t *testing.T) {
+	ctx := &Context{Context: context.Background()}
+	ctx.Set("name", "anthony")
+	ctx.Set("age", 30)
+	ctx.Set("admin", true)
+
+	if v, ok := ctx.GetString("name"); !ok || v != "anthony" {
+		t.Errorf("expecting anthony have %s", v)
+	}
+	if v, ok := ctx.GetInt("age"); !ok || v != 30 {
+		t.Errorf("expecting 30 have %d", v)
+	}
+	if v, ok := ctx.GetBool("admin"); !ok || !v {
+		t.Error("expecting admin to be true")
+	}
+	if _, ok := ctx.GetInt("name"); ok {
+		t.Error("expecting GetInt of a string to fail")
+	}
+	if _, ok := ctx.GetString("missing"); ok {
+		t.Error("expecting GetString of a missing key to fail")
+	}
+	if _, ok := ctx.GetOk("missing"); ok {
+		t.Error("expecting GetOk of a missing key to fail")
+	}
+	if v, ok := (&Context{}).GetOk("name"); ok || v != nil {
+		t.Errorf("expecting nil have %v", v)
+	}
+	ctx.Set("user", nil)
+	if v, ok := ctx.GetOk("user"); !ok || v != nil {
+		t.Errorf("expecting a nil value to be set have %v %t", v, ok)
+	}
+}
+
+func TestErrorAfterWrite(t *testing.T) {
+	logger := &logRecorder{}
+	w := New()
+	w.SetLogger(logger)
+	w.Get("/", func(c *Context) error {
+		c.Text(http.StatusOK, "partial")
+		return errors.New("failed")
+	})
+
+	var errLog bytes.Buffer
+	srv := httptest.NewUnstartedServer(w)
+	srv.Config.ErrorLog = log.New(&errLog, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	isHTTPStatusOK(t, resp.StatusCode)
+	if want, have := "partial", string(body); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if strings.Contains(errLog.String(), "superfluous") {
+		t.Errorf("expecting no superfluous WriteHeader call: %s", errLog.String())
+	}
+	if want, have := 1, len(logger.lines); want != have {
+		t.Errorf("expecting %d logged error have %d", want, have)
+	}
+}
+
+func TestOnFinish(t *testing.T) {
+	var order []string
+	w := New()
+	w.SetLogger(kitlog.NewNopLogger())
+	w.OnFinish(func(c *Context) {
+		order = append(order, fmt.Sprintf("app1 %d", c.StatusCode()))
+	})
+	w.OnFinish(func(c *Context) {
+		order = append(order, "app2")
+	})
+	w.Get("/", func(c *Context) error {
+		c.OnFinish(func(c *Context) { order = append(order, "ctx1") })
+		c.OnFinish(func(c *Context) { order = append(order, "ctx2") })
+		return errors.New("failed")
+	})
+	w.Get("/panic", func(c *Context) error {
+		panic("boom")
+	})
+
+	doRequest(t, "GET", "/", nil, w)
+	if want, have := "ctx2 ctx1 app2 app1 500", strings.Join(order, " "); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	order = nil
+	doRequest(t, "GET", "/panic", nil, w)
+	if want, have := "app2 app1 500", strings.Join(order, " "); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	var order []string
+	w := New()
+	w.SetErrorHandler(func(c *Context, err error) {
+		order = append(order, "error "+err.Error())
+		c.Text(http.StatusUnauthorized, err.Error())
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			order = append(order, "acquire")
+			c.OnFinish(func(*Context) { order = append(order, "release") })
+			return next(c)
+		}
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			order = append(order, "auth")
+			return errors.New("unauthorized")
+		}
+	})
+	w.Use(func(next Handler) Handler {
+		return func(c *Context) error {
+			order = append(order, "skipped")
 			return next(c)
 		}
 	})
+	w.Get("/", func(c *Context) error {
+		order = append(order, "handler")
+		return nil
+	})
 
-	w.Get("/", noopHandler)
 	code, _ := doRequest(t, "GET", "/", nil, w)
-	isHTTPStatusOK(t, code)
-	if buf.String() != "abcd" {
-		t.Error("expecting abcd got %s", buf.String())
+	if want, have := http.StatusUnauthorized, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "acquire,auth,error unauthorized,release", strings.Join(order, ","); want != have {
+		t.Errorf("expecting %s have %s", want, have)
 	}
 }
 
-func TestBoxMiddlewareReset(t *testing.T) {
-	buf := &bytes.Buffer{}
+func TestContextAbort(t *testing.T) {
+	var order []string
 	w := New()
-
 	w.Use(func(next Handler) Handler {
 		return func(c *Context) error {
-			buf.WriteString("a")
-			return next(c)
+			order = append(order, "outer")
+			err := next(c)
+			order = append(order, fmt.Sprintf("aborted %t", c.IsAborted()))
+			return err
 		}
 	})
 	w.Use(func(next Handler) Handler {
 		return func(c *Context) error {
-			buf.WriteString("b")
+			order = append(order, "cache")
+			if c.Query("cached") != "" {
+				c.Abort()
+				c.Text(http.StatusOK, "cached")
+			}
+			// a middleware that ignores the abort does not reach the handler
+			return next(c)
+		}
+	})
+	w.Get("/", func(c *Context) error {
+		order = append(order, "handler")
+		return c.Text(http.StatusOK, "fresh")
+	}, func(next Handler) Handler {
+		return func(c *Context) error {
+			order = append(order, "route")
 			return next(c)
 		}
 	})
 
-	sub := w.Box("/sub").ResetMiddleware()
-	sub.Get("/", noopHandler)
-	code, _ := doRequest(t, "GET", "/sub", nil, w)
+	code, body := doRequest(t, "GET", "/?cached=1", nil, w)
 	isHTTPStatusOK(t, code)
-	if buf.String() != "" {
-		t.Error("expecting empty buffer got %s", buf.String())
+	if want, have := "cached", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "outer,cache,aborted true", strings.Join(order, ","); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	order = nil
+	_, body = doRequest(t, "GET", "/", nil, w)
+	if want, have := "fresh", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "outer,cache,route,handler,aborted false", strings.Join(order, ","); want != have {
+		t.Errorf("expecting %s have %s", want, have)
 	}
 }
 
-func TestBoxMiddlewareInheritsParent(t *testing.T) {
-	buf := &bytes.Buffer{}
+func TestContextTypedKeys(t *testing.T) {
+	type otherKey string
+	type key string
 	w := New()
-
 	w.Use(func(next Handler) Handler {
 		return func(c *Context) error {
-			buf.WriteString("a")
+			c.Set(otherKey("user"), "other")
+			c.Set(key("user"), "anthony")
 			return next(c)
 		}
 	})
-	w.Use(func(next Handler) Handler {
-		return func(c *Context) error {
-			buf.WriteString("b")
-			return next(c)
-		}
+	w.Get("/", func(c *Context) error {
+		name, _ := c.GetString(key("user"))
+		other, _ := c.Context.Value(otherKey("user")).(string)
+		_, ok := c.GetOk("user")
+		return c.Text(http.StatusOK, fmt.Sprintf("%s %s %t", name, other, ok))
 	})
 
-	sub := w.Box("/sub")
-	sub.Get("/", noopHandler)
-	code, _ := doRequest(t, "GET", "/sub", nil, w)
-	isHTTPStatusOK(t, code)
-	if buf.String() != "ab" {
-		t.Error("expecting ab got %s", buf.String())
+	_, body := doRequest(t, "GET", "/", nil, w)
+	if want, have := "anthony other false", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
 	}
 }
 
-func TestParentNotInheritBoxMiddleware(t *testing.T) {
-	buf := &bytes.Buffer{}
+func TestContextParamIntQueryInt(t *testing.T) {
 	w := New()
-	w.Get("/foo", noopHandler)
-	sub := w.Box("/sub")
-
-	sub.Use(func(next Handler) Handler {
-		return func(c *Context) error {
-			buf.WriteString("a")
-			return next(c)
+	w.Get("/users/:id", func(c *Context) error {
+		id, err := c.ParamInt("id")
+		if err != nil {
+			return err
+		}
+		page, err := c.QueryInt("page")
+		if err != nil {
+			return err
 		}
+		return c.Text(http.StatusOK, fmt.Sprintf("%d %d", id, page))
 	})
 
-	doRequest(t, "GET", "/foo", nil, w)
-	if buf.String() == "a" {
-		t.Error("parent cannot inherit box middleware")
+	tests := []struct {
+		route string
+		code  int
+		body  string
+	}{
+		{"/users/42?page=2", http.StatusOK, "42 2"},
+		{"/users/anthony?page=2", http.StatusBadRequest, "parameter id must be an integer"},
+		{"/users/42", http.StatusBadRequest, "missing query parameter page"},
+		{"/users/42?page=two", http.StatusBadRequest, "query parameter page must be an integer"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
+		if want, have := test.code, code; want != have {
+			t.Errorf("%s: expecting %d have %d", test.route, want, have)
+		}
+		if !strings.Contains(body, test.body) {
+			t.Errorf("%s: expecting %s have %s", test.route, test.body, body)
+		}
 	}
-}
 
-func TestErrorHandler(t *testing.T) {
-	w := New()
-	errorMsg := "oops! something went wrong"
-	w.SetErrorHandler(func(ctx *Context, err error) {
-		ctx.Response().WriteHeader(http.StatusInternalServerError)
-		if err.Error() != errorMsg {
-			t.Error("expecting %s, got %s", errorMsg, err.Error())
+	w = New()
+	w.Get("/:id", func(c *Context) error {
+		_, err := c.ParamInt("id")
+		if _, ok := err.(HTTPError); !ok {
+			t.Errorf("expecting an HTTPError have %T", err)
 		}
+		return nil
 	})
+	doRequest(t, "GET", "/x", nil, w)
+}
 
-	w.Use(func(next Handler) Handler {
-		return func(c *Context) error {
-			return errors.New(errorMsg)
+func TestContextWriter(t *testing.T) {
+	w := New()
+	w.Get("/export", func(c *Context) error {
+		out := c.Writer(http.StatusOK, "text/csv")
+		for i := 0; i < 3; i++ {
+			if _, err := fmt.Fprintf(out, "row,%d\n", i); err != nil {
+				return err
+			}
 		}
+		return nil
 	})
 
-	w.Get("/", noopHandler)
-	code, _ := doRequest(t, "GET", "/", nil, w)
-	if code != http.StatusInternalServerError {
-		t.Error("expecting code 500 got %s", code)
+	r, _ := http.NewRequest("GET", "/export", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "text/csv", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "row,0\nrow,1\nrow,2\n", rw.Body.String(); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if !rw.Flushed {
+		t.Error("expecting the response to be flushed")
 	}
 }
 
-func TestWeaveboxHandler(t *testing.T) {
+func TestContextBoxPath(t *testing.T) {
 	w := New()
-	handle := func(respStr string) Handler {
-		return func(ctx *Context) error {
-			return ctx.Text(http.StatusOK, respStr)
-		}
+	w.CaseInsensitive = true
+	paths := func(c *Context) error {
+		return c.Text(http.StatusOK, c.Path()+" "+c.BoxPath())
 	}
-	w.Get("/a", handle("a"))
-	w.Get("/b", handle("b"))
-	w.Get("/c", handle("c"))
+	w.Get("/users", paths)
+	admin := w.Box("/admin")
+	admin.Get("/", paths)
+	admin.Get("/users/:id", paths)
+	admin.Box("/v1").Get("/stats", paths)
+	w.Box("/orgs/:org").Get("/users", paths)
+	w.Box("/teams/{team}/").Get("/", paths)
 
-	for _, r := range []string{"a", "b", "c"} {
-		code, body := doRequest(t, "GET", "/"+r, nil, w)
+	tests := []struct {
+		route string
+		body  string
+	}{
+		{"/users", "/users /users"},
+		{"/admin", "/admin /"},
+		{"/admin/users/1", "/admin/users/1 /users/1"},
+		{"/Admin/Users/1", "/Admin/Users/1 /Users/1"},
+		{"/admin/v1/stats", "/admin/v1/stats /stats"},
+		{"/orgs/acme/users", "/orgs/acme/users /users"},
+		{"/teams/core", "/teams/core /"},
+	}
+	for _, test := range tests {
+		code, body := doRequest(t, "GET", test.route, nil, w)
 		isHTTPStatusOK(t, code)
-		if body != r {
-			t.Errorf("expecting %s got %s", r, body)
+		if want, have := test.body, body; want != have {
+			t.Errorf("%s: expecting %s have %s", test.route, want, have)
 		}
 	}
 }
 
-func TestNotFoundHandler(t *testing.T) {
+func TestContextError(t *testing.T) {
+	logger := &logRecorder{}
 	w := New()
+	w.SetLogger(logger)
+	w.Get("/", func(c *Context) error {
+		return c.Error(http.StatusNotFound, "user not found")
+	})
+
 	code, body := doRequest(t, "GET", "/", nil, w)
-	if code != http.StatusNotFound {
-		t.Errorf("expecting code 404 got %d", code)
+	if want, have := http.StatusNotFound, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
 	}
-	if !strings.Contains(body, "404 page not found") {
-		t.Errorf("expecting body: 404 page not found got %s", body)
+	if want, have := `{"code":404,"description":"user not found"}`, strings.TrimSpace(body); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := 0, len(logger.lines); want != have {
+		t.Errorf("expecting %d logged lines have %d", want, have)
+	}
+
+	w.SetErrorHandler(func(c *Context, err error) {
+		c.Text(err.(HTTPError).Code, "custom "+err.Error())
+	})
+	code, body = doRequest(t, "GET", "/", nil, w)
+	if want, have := http.StatusNotFound, code; want != have {
+		t.Errorf("expecting %d have %d", want, have)
+	}
+	if want, have := "custom user not found", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
 	}
 }
 
-func TestSetNotFound(t *testing.T) {
+func TestMetricsObserver(t *testing.T) {
+	var observed []string
 	w := New()
-	notFoundMsg := "hey! not found"
-	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(notFoundMsg))
+	w.SetMetricsObserver(func(method, route string, status int, dur time.Duration) {
+		if dur <= 0 {
+			t.Errorf("expecting a positive duration have %s", dur)
+		}
+		observed = append(observed, fmt.Sprintf("%s %s %d", method, route, status))
+	})
+	api := w.Box("/api")
+	api.Get("/users/:id", noopHandler)
+	api.Post("/users", func(c *Context) error {
+		return c.Text(http.StatusCreated, "created")
 	})
-	w.SetNotFoundHandler(h)
 
-	code, body := doRequest(t, "GET", "/", nil, w)
-	if code != http.StatusNotFound {
-		t.Errorf("expecting code 404 got %d", code)
+	doRequest(t, "GET", "/api/users/1", nil, w)
+	doRequest(t, "POST", "/api/users", nil, w)
+	doRequest(t, "GET", "/nope", nil, w)
+	want := []string{
+		"GET /api/users/:id 200",
+		"POST /api/users 201",
+		"GET  404",
 	}
-	if !strings.Contains(body, notFoundMsg) {
-		t.Errorf("expecting body: %s got %s", notFoundMsg, body)
+	if have := observed; strings.Join(want, ",") != strings.Join(have, ",") {
+		t.Errorf("expecting %v have %v", want, have)
 	}
 }
 
-func TestMethodNotAllowed(t *testing.T) {
+type slowReader struct {
+	delay time.Duration
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return 0, io.EOF
+}
+
+func TestContextBind(t *testing.T) {
 	w := New()
-	w.Get("/", noopHandler)
-	code, body := doRequest(t, "POST", "/", nil, w)
-	if code != http.StatusMethodNotAllowed {
-		t.Errorf("expecting code 405 got %d", code)
-	}
-	if !strings.Contains(body, "Method Not Allowed") {
-		t.Errorf("expecting body: Method Not Allowed got %s", body)
+	w.Post("/", func(c *Context) error {
+		var v struct{ Name string }
+		if err := c.Bind(&v); err != nil {
+			return err
+		}
+		return c.Text(http.StatusOK, v.Name)
+	})
+
+	code, body := doRequest(t, "POST", "/", strings.NewReader(`{"name":"anthony"}`), w)
+	isHTTPStatusOK(t, code)
+	if want, have := "anthony", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
 	}
 }
 
-func TestSetMethodNotAllowed(t *testing.T) {
+func TestContextMustBind(t *testing.T) {
 	w := New()
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		w.Write([]byte("foo"))
+	w.Post("/", func(c *Context) error {
+		var v struct{ Name string }
+		if !c.MustBind(&v) {
+			return nil
+		}
+		return c.Text(http.StatusOK, v.Name)
 	})
-	w.SetMethodNotAllowed(handler)
-	w.Get("/", noopHandler)
 
-	code, body := doRequest(t, "POST", "/", nil, w)
-	if code != http.StatusMethodNotAllowed {
-		t.Errorf("expecting code 405 got %d", code)
+	code, body := doRequest(t, "POST", "/", strings.NewReader(`{"name":"anthony"}`), w)
+	isHTTPStatusOK(t, code)
+	if want, have := "anthony", body; want != have {
+		t.Errorf("expecting %s have %s", want, have)
 	}
-	if !strings.Contains(body, "foo") {
-		t.Errorf("expecting body: foo got %s", body)
+	// a malformed body is a client error, written once by the ErrorHandler
+	code, body = doRequest(t, "POST", "/", strings.NewReader(`{"name":`), w)
+	if want, have := http.StatusBadRequest, code; want != have {
+		t.Errorf("expecting code %d have %d", want, have)
 	}
-}
-
-func TestContextURLQuery(t *testing.T) {
-	req, _ := http.NewRequest("GET", "/?name=anthony", nil)
-	ctx := &Context{request: req}
-	if ctx.Query("name") != "anthony" {
-		t.Errorf("expected anthony got %s", ctx.Query("name"))
+	if want, have := "unexpected end of JSON input", body; !strings.Contains(have, want) {
+		t.Errorf("expecting %s in %s", want, have)
 	}
 }
 
-func TestContextForm(t *testing.T) {
-	values := url.Values{}
-	values.Set("email", "john@gmail.com")
-	req, _ := http.NewRequest("POST", "/", strings.NewReader(values.Encode()))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	ctx := &Context{request: req}
-	if ctx.Form("email") != "john@gmail.com" {
-		t.Errorf("expected john@gmail.com got %s", ctx.Form("email"))
-	}
-}
+func TestContextBindTimeout(t *testing.T) {
+	w := New()
+	w.BodyReadTimeout = 10 * time.Millisecond
+	w.Post("/", func(c *Context) error {
+		var v struct{ Name string }
+		return c.Bind(&v)
+	})
 
-func TestContextHeader(t *testing.T) {
-	req, _ := http.NewRequest("GET", "/", nil)
-	req.Header.Add("x-test", "test")
-	ctx := &Context{request: req}
-	if ctx.Header("x-test") != "test" {
-		t.Error("expected header to be (test) got %s", ctx.Header("x-test"))
+	code, _ := doRequest(t, "POST", "/", slowReader{100 * time.Millisecond}, w)
+	if code != http.StatusRequestTimeout {
+		t.Errorf("expecting code 408 got %d", code)
 	}
 }
 
-func TestSetHeader(t *testing.T) {
-	req, _ := http.NewRequest("GET", "/", nil)
-	resp := httptest.NewRecorder()
-	ctx := &Context{request: req, response: resp}
+func TestContextBindTimeoutStalledClient(t *testing.T) {
+	w := New()
+	w.BodyReadTimeout = 50 * time.Millisecond
+	w.Post("/", func(c *Context) error {
+		var v struct{ Name string }
+		return c.Bind(&v)
+	})
+	ts := httptest.NewServer(w)
+	defer ts.Close()
 
-	ctx.SetHeader("X-Test", "foo")
-	ctx.SetHeader("X-Test", "bar")
-	if want, have := "bar", ctx.response.Header().Get("X-Test"); want != have {
-		t.Errorf("expecting %s have %s", want, have)
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// announce a body of 100 bytes, but send only the first one
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: example.com\r\n"+
+		"Content-Type: application/json\r\nContent-Length: 100\r\n\r\n{")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expecting code 408 got %d", resp.StatusCode)
 	}
 }
 
-func TestContextSetGet(t *testing.T) {
+func TestContextSetGetErrorHandler(t *testing.T) {
 	w := New()
+	w.SetErrorHandler(func(c *Context, err error) {
+		if want, have := "anthony", c.Get("user"); want != have {
+			t.Errorf("expected %s but got %v", want, have)
+		}
+		c.Response().WriteHeader(http.StatusInternalServerError)
+	})
 	w.Use(func(next Handler) Handler {
 		return func(c *Context) error {
-			c.Set("foo", "bar")
-			return nil
+			c.Set("user", "anthony")
+			return next(c)
 		}
 	})
 	w.Use(func(next Handler) Handler {
 		return func(c *Context) error {
-			if want, have := "bar", c.Get("foo").(string); want != have {
-				t.Error("expected %s but got %s", want, have)
-			}
-			return nil
+			// replacing the context should not drop the stored values
+			c.Context = context.Background()
+			return next(c)
 		}
 	})
-	w.Get("/", noopHandler)
+	w.Get("/", func(c *Context) error {
+		if want, have := "anthony", c.Get("user"); want != have {
+			t.Errorf("expected %s but got %v", want, have)
+		}
+		return errors.New("oops")
+	})
+
 	code, _ := doRequest(t, "GET", "/", nil, w)
-	isHTTPStatusOK(t, code)
+	if code != http.StatusInternalServerError {
+		t.Errorf("expecting code 500 got %d", code)
+	}
 }
 
 func TestHTTPError(t *testing.T) {
@@ -471,6 +2457,64 @@ func TestHTTPError(t *testing.T) {
 	}
 }
 
+func TestDefaultErrorHandlerValidationErrors(t *testing.T) {
+	w := New()
+	w.Post("/users", func(c *Context) error {
+		return ValidationErrors{
+			{Field: "email", Message: "is required"},
+			{Field: "age", Message: "must be positive"},
+		}
+	})
+
+	code, body := doRequest(t, "POST", "/users", nil, w)
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("expecting code 422 got %d", code)
+	}
+	var errs []ValidationError
+	if err := json.NewDecoder(strings.NewReader(body)).Decode(&errs); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expecting 2 validation errors got %d", len(errs))
+	}
+	if want, have := "email", errs[0].Field; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "must be positive", errs[1].Message; want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
+func TestNoSniff(t *testing.T) {
+	w := New()
+	w.NoSniff = true
+	w.Get("/raw", func(c *Context) error {
+		_, err := c.Response().Write([]byte("<html></html>"))
+		return err
+	})
+	w.Get("/text", func(c *Context) error {
+		return c.Text(http.StatusOK, "<html></html>")
+	})
+
+	r, _ := http.NewRequest("GET", "/raw", nil)
+	rw := httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	isHTTPStatusOK(t, rw.Code)
+	if want, have := "application/octet-stream", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+	if want, have := "nosniff", rw.Header().Get("X-Content-Type-Options"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+
+	r, _ = http.NewRequest("GET", "/text", nil)
+	rw = httptest.NewRecorder()
+	w.ServeHTTP(rw, r)
+	if want, have := "text/plain; charset=utf-8", rw.Header().Get("Content-Type"); want != have {
+		t.Errorf("expecting %s have %s", want, have)
+	}
+}
+
 func isHTTPStatusOK(t *testing.T, code int) {
 	if code != http.StatusOK {
 		t.Errorf("Expecting status 200 got %d", code)
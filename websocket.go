@@ -0,0 +1,29 @@
+package weavebox
+
+import (
+	"errors"
+
+	"golang.org/x/net/websocket"
+)
+
+// ErrResponseWritten is returned by WebSocket when the response has already
+// been written, so the connection can no longer be upgraded.
+var ErrResponseWritten = errors.New("weavebox: response already written")
+
+// WebSocket upgrades the request to a WebSocket connection and calls h with
+// the connection. The connection is closed when h returns, after which
+// ErrHandled is returned so the Handler can return it directly. Nothing may be
+// written to the response before calling WebSocket, otherwise
+// ErrResponseWritten is returned.
+// 	app.Get("/ws", func(c *weavebox.Context) error {
+// 		return c.WebSocket(func(conn *websocket.Conn) {
+// 			io.Copy(conn, conn)
+// 		})
+// 	})
+func (c *Context) WebSocket(h func(*websocket.Conn)) error {
+	if c.Written() {
+		return ErrResponseWritten
+	}
+	websocket.Handler(h).ServeHTTP(c.response, c.request)
+	return ErrHandled
+}
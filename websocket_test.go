@@ -0,0 +1,24 @@
+package weavebox
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketAfterWrite(t *testing.T) {
+	w := New()
+	w.Get("/ws", func(c *Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		err := c.WebSocket(func(conn *websocket.Conn) {
+			t.Error("connection should not be upgraded")
+		})
+		if err != ErrResponseWritten {
+			t.Errorf("expecting ErrResponseWritten got %v", err)
+		}
+		return nil
+	})
+	code, _ := doRequest(t, "GET", "/ws", nil, w)
+	isHTTPStatusOK(t, code)
+}